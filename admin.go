@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// adminAuthMiddleware only lets through requests carrying the admin token,
+// either as "Authorization: Bearer <token>" or in X-Admin-Token
+func adminAuthMiddleware(token string) func(http.Handler) http.Handler {
+	expected := sha256.Sum256([]byte(token))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			supplied := r.Header.Get("X-Admin-Token")
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				supplied = bearer
+			}
+			suppliedHash := sha256.Sum256([]byte(supplied))
+			if supplied == "" || subtle.ConstantTimeCompare(suppliedHash[:], expected[:]) != 1 {
+				requestLogger(r.Context()).Warn("Rejected admin request", "path", r.URL.Path)
+				writeJSONError(w, http.StatusUnauthorized, "Invalid admin token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ReloadResponse structure for the dictionary reload endpoint
+type ReloadResponse struct {
+	ProfanityWords int    `json:"profanity_words"`
+	DictVersion    string `json:"dict_version"`
+}
+
+// reloadDictionaryHandler re-reads the dictionary file, or the embedded list
+// when there is none, and swaps it in.
+// Jobs already running finish with the dictionary they started with.
+func reloadDictionaryHandler(w http.ResponseWriter, r *http.Request) {
+	dict, err := loadMainDictionary()
+	if err != nil {
+		slog.Error("Dictionary reload failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to reload dictionary: "+err.Error())
+		return
+	}
+	languages, err := loadLanguageDictionaries(languageDictionaryDir)
+	if err != nil {
+		slog.Error("Language dictionary reload failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to reload language dictionaries: "+err.Error())
+		return
+	}
+	allowed, err := loadAllowlistFile(allowlistPath)
+	if err != nil {
+		slog.Error("Allowlist reload failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to reload allowlist: "+err.Error())
+		return
+	}
+	dict = dict.withLanguages(languages).withAllowlist(allowed)
+	setDictionary(dict)
+	slog.Info("Reloaded dictionary", "words", len(dict.words), "languages", len(dict.languages),
+		"allowlisted", len(dict.allowed), "dict_version", dict.version)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReloadResponse{ProfanityWords: len(dict.words), DictVersion: dict.version})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+func TestReloadRecoversFromMissingDictionary(t *testing.T) {
+	withoutFallbacks(t)
+	previous := currentDictionary()
+	t.Cleanup(func() { setDictionary(previous) })
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "oh shit")}, nil
+	}))
+
+	// As started with DICTIONARY_FALLBACK=none after the word list failed to load
+	setDictionary(newDictionary(wordList{}, "none"))
+
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=reload00001", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503: %s", rec.Code, rec.Body)
+	}
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatal(err)
+	}
+	if errorResponse.Error != errDictionaryNotLoaded {
+		t.Errorf("error = %q, want %q", errorResponse.Error, errDictionaryNotLoaded)
+	}
+
+	rec = httptest.NewRecorder()
+	healthHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "dictionary is not loaded") {
+		t.Errorf("healthz = %d: %s", rec.Code, rec.Body)
+	}
+
+	reload := adminAuthMiddleware("secret")(http.HandlerFunc(reloadDictionaryHandler))
+	rec = httptest.NewRecorder()
+	reload.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/reload-dictionary", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("reload without a token = %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/reload-dictionary", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	reload.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d: %s", rec.Code, rec.Body)
+	}
+	var reloaded ReloadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.ProfanityWords == 0 || reloaded.DictVersion != currentDictionary().version {
+		t.Errorf("reload = %+v", reloaded)
+	}
+
+	rec = httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=reload00001", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after reload = %d: %s", rec.Code, rec.Body)
+	}
+	var response TranscriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Profanity {
+		t.Error("reloaded dictionary didn't flag the transcript")
+	}
+}
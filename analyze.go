@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+)
+
+// WordCount is how often one dictionary entry matched
+type WordCount struct {
+	Word     string `json:"word"`  // As it first appeared in the transcript
+	Entry    string `json:"entry"` // The dictionary entry it matched
+	Count    int    `json:"count"`
+	Category string `json:"category"`
+	Severity int    `json:"severity"`
+	Track    string `json:"track,omitempty"` // Track with the highest count, only with tracks=all
+}
+
+// AnalysisVerdict is the overall judgement of a video
+type AnalysisVerdict struct {
+	Profane        bool    `json:"profane"`
+	AudienceRating string  `json:"audience_rating"`
+	SeverityScore  float64 `json:"severity_score"`
+	ProfanityScore int     `json:"profanity_score"`
+	MaxSeverity    int     `json:"max_severity"`
+	// Only for clean videos, see cleanConfidence
+	CleanConfidence string   `json:"clean_confidence,omitempty"`
+	Notes           []string `json:"notes,omitempty"`
+}
+
+// AnalysisStats summarizes how much profanity was found
+type AnalysisStats struct {
+	Hits          int     `json:"hits"`
+	DistinctWords int     `json:"distinct_words"`
+	WordsScanned  int     `json:"words_scanned"`
+	Density       float64 `json:"density"`
+}
+
+// AnalysisCoverage describes how much of the transcript was scanned
+type AnalysisCoverage struct {
+	ScannedRange        *TimeRange `json:"scanned_range,omitempty"`
+	SegmentsScanned     int        `json:"segments_scanned"`
+	SegmentsTotal       int        `json:"segments_total"`
+	Partial             bool       `json:"partial"`
+	Truncated           bool       `json:"truncated"`
+	OverlappingSegments int        `json:"overlapping_segments"`
+	Deduplicated        bool       `json:"deduplicated"`
+}
+
+// AnalysisResponse is the full breakdown returned by /analyze
+type AnalysisResponse struct {
+	VideoID     string           `json:"video_id"`
+	Tag         string           `json:"tag,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Detected    string           `json:"detected_language,omitempty"`
+	Confidence  float64          `json:"language_confidence,omitempty"`
+	CaptionType captionKind      `json:"caption_type,omitempty"`
+	Attempts    []AttemptResult  `json:"language_attempts,omitempty"`
+	DictVersion string           `json:"dict_version"`
+	Verdict     AnalysisVerdict  `json:"verdict"`
+	Stats       AnalysisStats    `json:"stats"`
+	Words       []WordCount      `json:"words"`
+	Categories  []string         `json:"categories"`
+	Segments    []Segment        `json:"segments"`
+	Tracks      []TrackResult    `json:"tracks,omitempty"`
+	Contexts    []MatchContext   `json:"contexts,omitempty"`
+	Coverage    AnalysisCoverage `json:"coverage"`
+	Transcript  string           `json:"transcript,omitempty"`
+	Offsets     []MatchOffset    `json:"match_offsets,omitempty"`
+	Metadata    *VideoMetadata   `json:"metadata,omitempty"`
+}
+
+// newAnalysisResponse regroups a worker result into the analysis layout
+func newAnalysisResponse(response TranscriptResponse) AnalysisResponse {
+	return AnalysisResponse{
+		VideoID:     response.VideoID,
+		Tag:         response.Tag,
+		Language:    response.Language,
+		Detected:    response.DetectedLanguage,
+		Confidence:  response.LanguageConfidence,
+		CaptionType: response.CaptionType,
+		Attempts:    response.LanguageAttempts,
+		DictVersion: response.DictVersion,
+		Verdict: AnalysisVerdict{
+			Profane:         response.Profanity,
+			AudienceRating:  response.AudienceRating,
+			SeverityScore:   response.SeverityScore,
+			ProfanityScore:  response.ProfanityScore,
+			MaxSeverity:     response.MaxSeverity,
+			CleanConfidence: response.CleanConfidence,
+			Notes:           response.Notes,
+		},
+		Stats: AnalysisStats{
+			Hits:          response.ProfanityCount,
+			DistinctWords: len(response.WordCounts),
+			WordsScanned:  response.WordsScanned,
+			Density:       response.ProfanityDensity,
+		},
+		Words:      response.WordCounts,
+		Categories: response.Categories,
+		Segments:   response.ProfanitySegments,
+		Tracks:     response.Tracks,
+		Contexts:   response.Contexts,
+		Coverage: AnalysisCoverage{
+			ScannedRange:        response.ScannedRange,
+			SegmentsScanned:     response.SegmentsScanned,
+			SegmentsTotal:       response.SegmentsTotal,
+			Partial:             response.Partial,
+			Truncated:           response.Truncated,
+			OverlappingSegments: response.OverlappingSegments,
+			Deduplicated:        response.Deduplicated,
+		},
+		Transcript: response.Transcript,
+		Offsets:    response.MatchOffsets,
+		Metadata:   response.Metadata,
+	}
+}
+
+// analyzeHandler is the canonical single video endpoint: it takes the same
+// parameters as /transcript/{video_id} and returns everything the scan found
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	response, ok := checkVideo(w, r, writeErrorResponse)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, newAnalysisResponse(response))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// basicAuthCredential is a single username/password pair allowed through the
+// basic-auth middleware. Both values are stored as SHA-256 digests so every
+// comparison is over fixed-length inputs.
+type basicAuthCredential struct {
+	username [sha256.Size]byte
+	password [sha256.Size]byte
+}
+
+// parseBasicAuthUsers parses a comma-separated "user:pass,user2:pass2" list.
+// Entries without a colon or with an empty username are skipped.
+func parseBasicAuthUsers(raw string) []basicAuthCredential {
+	var credentials []basicAuthCredential
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		username, password, ok := strings.Cut(entry, ":")
+		if !ok || username == "" {
+			slog.Warn("Ignoring malformed BASIC_AUTH_USERS entry")
+			continue
+		}
+		credentials = append(credentials, basicAuthCredential{
+			username: sha256.Sum256([]byte(username)),
+			password: sha256.Sum256([]byte(password)),
+		})
+	}
+	return credentials
+}
+
+// publicPaths are reachable without credentials so orchestration probes keep
+// working when auth is on
+var publicPaths = map[string]bool{
+	"/healthz": true,
+}
+
+// basicAuthMiddleware rejects requests that don't carry one of the configured
+// credentials. With no credentials configured it is a no-op.
+func basicAuthMiddleware(credentials []basicAuthCredential) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(credentials) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			username, password, ok := r.BasicAuth()
+			if !ok || !checkBasicAuth(credentials, username, password) {
+				requestLogger(r.Context()).Warn("Rejected unauthenticated request", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", `Basic realm="youtube-profanity-check", charset="UTF-8"`)
+				writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkBasicAuth compares against every configured credential without
+// short-circuiting so timing doesn't reveal which username matched.
+func checkBasicAuth(credentials []basicAuthCredential, username, password string) bool {
+	userHash := sha256.Sum256([]byte(username))
+	passHash := sha256.Sum256([]byte(password))
+	matched := 0
+	for _, c := range credentials {
+		userMatch := subtle.ConstantTimeCompare(userHash[:], c.username[:])
+		passMatch := subtle.ConstantTimeCompare(passHash[:], c.password[:])
+		matched |= userMatch & passMatch
+	}
+	return matched == 1
+}
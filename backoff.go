@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Retry backoff settings. Each retry waits retryBaseDelay * 2^attempt with
+// jitter, and a job sleeps at most maxRetryDuration in total across all of
+// its retries (MAX_RETRY_DURATION_MS).
+var (
+	retryBaseDelay   = time.Second
+	maxRetryDuration = 15 * time.Second
+)
+
+// backoff hands out retry delays for one job. Delays are "equal jitter":
+// half the exponential delay plus a random share of the other half, so
+// workers that failed together don't retry in lockstep while every delay
+// stays within a factor of two of the schedule.
+type backoff struct {
+	base   time.Duration
+	budget time.Duration // Total sleep left for the job
+	random func() float64
+}
+
+// retrySleep waits out a retry delay. Tests swap it for a fake clock so
+// retries don't take real time.
+var retrySleep = sleepContext
+
+func newBackoff() *backoff {
+	return &backoff{base: retryBaseDelay, budget: maxRetryDuration, random: rand.Float64}
+}
+
+// next returns the delay before the given retry attempt (1 for the first
+// retry), or false when the job has used up its retry budget
+func (b *backoff) next(attempt int) (time.Duration, bool) {
+	if b.budget <= 0 {
+		return 0, false
+	}
+	delay := b.base << attempt
+	if delay <= 0 || delay > b.budget*2 {
+		// Shifted past the budget, or overflowed
+		delay = b.budget * 2
+	}
+	delay = delay/2 + time.Duration(b.random()*float64(delay/2))
+	delay = min(delay, b.budget)
+	b.budget -= delay
+	return delay, true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fixedRandom always returns value, in place of rand.Float64
+func fixedRandom(value float64) func() float64 {
+	return func() float64 { return value }
+}
+
+func TestBackoffSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		random float64
+		want   []time.Duration // Delay for attempts 1, 2, ... until the budget is gone
+	}{
+		// Half the exponential delay with no jitter: 1s, 2s, 4s, then the
+		// remaining 8s budget caps the last one
+		{"no jitter", 0, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		// Full jitter doubles each delay until the budget runs out
+		{"full jitter", 1, []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, time.Second}},
+		{"half jitter", 0.5, []time.Duration{1500 * time.Millisecond, 3 * time.Second, 6 * time.Second, 4500 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &backoff{base: time.Second, budget: 15 * time.Second, random: fixedRandom(tt.random)}
+			var got []time.Duration
+			for attempt := 1; ; attempt++ {
+				delay, ok := b.next(attempt)
+				if !ok {
+					break
+				}
+				got = append(got, delay)
+				if attempt > 10 {
+					t.Fatal("budget never ran out")
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("delays = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("delays = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffStaysWithinBounds(t *testing.T) {
+	for _, random := range []float64{0, 0.25, 0.5, 0.75, 0.999} {
+		b := &backoff{base: time.Second, budget: 15 * time.Second, random: fixedRandom(random)}
+		var total time.Duration
+		for attempt := 1; attempt <= 70; attempt++ { // Far enough to overflow the shift
+			delay, ok := b.next(attempt)
+			if !ok {
+				break
+			}
+			scheduled := time.Second << attempt
+			if delay < 0 || (scheduled > 0 && delay > scheduled) {
+				t.Errorf("random %v attempt %d: delay %v outside [0, %v]", random, attempt, delay, scheduled)
+			}
+			total += delay
+		}
+		if total > 15*time.Second {
+			t.Errorf("random %v: slept %v in total, over the 15s budget", random, total)
+		}
+	}
+}
+
+func TestFetchRetriesWithFakeClock(t *testing.T) {
+	previousSleep, previousBudget, previousBase := retrySleep, maxRetryDuration, retryBaseDelay
+	t.Cleanup(func() { retrySleep, maxRetryDuration, retryBaseDelay = previousSleep, previousBudget, previousBase })
+	retryBaseDelay, maxRetryDuration = time.Second, 3*time.Second
+
+	var slept []time.Duration
+	retrySleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	start := time.Now()
+	_, _, attempts, err := fetchTranscript(context.Background(), failingFetcher("connection reset by peer"), "backoff0001", []string{"en", "es"}, captionsAny)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetch took %v with a fake clock", elapsed)
+	}
+
+	var total time.Duration
+	for _, d := range slept {
+		total += d
+	}
+	if total > maxRetryDuration {
+		t.Errorf("slept %v in total (%v), over the %v budget", total, slept, maxRetryDuration)
+	}
+	// The budget is shared by every language of the job
+	if len(attempts) != 2 || attempts[0].Attempts+attempts[1].Attempts != 2+len(slept) {
+		t.Errorf("attempts = %+v after sleeping %v", attempts, slept)
+	}
+}
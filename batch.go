@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// maxBatchSize caps how many videos a single batch request may contain
+const maxBatchSize = 100
+
+// BatchRequest is the body accepted by the batch endpoint. Videos can be
+// listed as bare IDs, which use the shared Lang, or as items that override
+// the language and carry a client tag.
+type BatchRequest struct {
+	VideoIDs []string    `json:"video_ids"`
+	Videos   []BatchItem `json:"videos"`
+	Lang     string      `json:"lang"` // Default language for every video
+}
+
+// BatchItem is a single video in a batch with optional per-item settings
+type BatchItem struct {
+	VideoID string `json:"video_id"`
+	Lang    string `json:"lang,omitempty"` // Overrides the batch language
+	Tag     string `json:"tag,omitempty"`  // Echoed back on this video's result
+}
+
+// VideoResult is the outcome for one video in a multi-video response. Error
+// is set instead of the profanity fields when that video couldn't be checked,
+// so one failure doesn't fail the whole response.
+type VideoResult struct {
+	TranscriptResponse
+	Error string `json:"error,omitempty"`
+}
+
+// newVideoResult exposes a worker error alongside the result
+func newVideoResult(response TranscriptResponse) VideoResult {
+	return VideoResult{TranscriptResponse: response, Error: response.Error}
+}
+
+// batchJobs turns a batch request into one job per video, applying the
+// per-item language where given and the batch default otherwise
+func batchJobs(req BatchRequest, options ScanOptions) ([]Job, error) {
+	items := make([]BatchItem, 0, len(req.VideoIDs)+len(req.Videos))
+	for _, videoID := range req.VideoIDs {
+		items = append(items, BatchItem{VideoID: videoID})
+	}
+	items = append(items, req.Videos...)
+
+	jobs := make([]Job, 0, len(items))
+	for i, item := range items {
+		if item.VideoID == "" {
+			return nil, fmt.Errorf("video %d is missing a video_id", i)
+		}
+		videoID, err := extractVideoID(item.VideoID)
+		if err != nil {
+			return nil, fmt.Errorf("video %d: invalid video ID or YouTube URL %q", i, item.VideoID)
+		}
+		lang := item.Lang
+		if lang == "" {
+			lang = req.Lang
+		}
+		if lang == "" {
+			lang = "en"
+		}
+		jobs = append(jobs, Job{
+			VideoID:   videoID,
+			Languages: []string{lang},
+			Options:   options,
+			Tag:       item.Tag,
+		})
+	}
+	return jobs, nil
+}
+
+// batchHandler checks several videos in one call and returns an array of
+// results in input order. A failed video only fails its own entry. With
+// stream=true results are instead written as newline-delimited JSON, one line
+// per video in completion order, flushed as soon as each finishes. With
+// sort=<metric> the array is ranked most profane first. With async=true the
+// batch runs in the background and its results are paged through with
+// batchJobHandler.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	stream := r.URL.Query().Get("stream") == "true"
+	async := r.URL.Query().Get("async") == "true"
+	if stream && async {
+		writeJSONError(w, http.StatusBadRequest, "async can't be combined with stream=true")
+		return
+	}
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy != "" {
+		if _, ok := batchSortKeys[sortBy]; !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported sort %q", sortBy))
+			return
+		}
+		if stream || async {
+			writeJSONError(w, http.StatusBadRequest, "sort can't be combined with stream=true or async=true")
+			return
+		}
+	}
+
+	options, err := parseScanOptions(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkDictionary(w, r) {
+		return
+	}
+
+	jobs, err := batchJobs(req, options)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(jobs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "The batch must contain at least one video")
+		return
+	}
+	limit := maxBatchSize
+	if async {
+		limit = maxAsyncBatchSize
+	}
+	if len(jobs) > limit {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Batch size %d exceeds the maximum of %d", len(jobs), limit))
+		return
+	}
+
+	if async {
+		acceptBatchJob(w, r, jobs)
+		return
+	}
+	if stream {
+		streamBatch(w, r, jobs)
+		return
+	}
+
+	results := collectBatch(r, jobs)
+	if sortBy != "" {
+		sortBatchResults(results, batchSortKeys[sortBy])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	json.NewEncoder(w).Encode(results)
+}
+
+// batchSortKeys maps the sort parameter to the metric videos are ranked by
+var batchSortKeys = map[string]func(TranscriptResponse) float64{
+	"count":           func(t TranscriptResponse) float64 { return float64(t.ProfanityCount) },
+	"density":         func(t TranscriptResponse) float64 { return t.ProfanityDensity },
+	"score":           func(t TranscriptResponse) float64 { return t.SeverityScore },
+	"profanity_score": func(t TranscriptResponse) float64 { return float64(t.ProfanityScore) },
+}
+
+// runBatch runs the jobs through the worker pool and calls done with each
+// result as it finishes. At most maxWorkers jobs are submitted at a time so a
+// large batch doesn't trip the queue depth limit, which is meant for separate
+// requests piling up. Jobs that hadn't started when ctx ends are reported as
+// abandoned. It returns once every job has been reported.
+func runBatch(ctx context.Context, jobs []Job, done func(i int, response TranscriptResponse)) {
+	slots := make(chan struct{}, maxWorkers)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		job.Ctx = ctx
+		started := false
+		select {
+		case slots <- struct{}{}:
+			// select picks at random when a slot frees up as ctx ends, so
+			// check again or a cancelled batch could still start jobs
+			if started = ctx.Err() == nil; !started {
+				<-slots
+			}
+		case <-ctx.Done():
+		}
+		if !started {
+			done(i, abandonedResponse(job))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			done(i, runJob(job))
+		}()
+	}
+	wg.Wait()
+}
+
+// collectBatch runs every job through the worker pool and waits for all of
+// them, returning results in input order
+func collectBatch(r *http.Request, jobs []Job) []VideoResult {
+	results := make([]VideoResult, len(jobs))
+	runBatch(r.Context(), jobs, func(i int, response TranscriptResponse) {
+		results[i] = newVideoResult(response)
+	})
+	return results
+}
+
+// sortBatchResults ranks results by the given metric, most profane first.
+// Failed videos go last and ties keep their input order.
+func sortBatchResults(results []VideoResult, key func(TranscriptResponse) float64) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Error == "") != (results[j].Error == "") {
+			return results[i].Error == ""
+		}
+		return key(results[i].TranscriptResponse) > key(results[j].TranscriptResponse)
+	})
+}
+
+// fanOutBatch runs the jobs on the worker pool in the background, see
+// runBatch, and delivers the results in completion order. The channel is
+// buffered for all of them so nothing leaks if the reader stops early.
+func fanOutBatch(ctx context.Context, jobs []Job) <-chan TranscriptResponse {
+	results := make(chan TranscriptResponse, len(jobs))
+	go runBatch(ctx, jobs, func(_ int, response TranscriptResponse) {
+		results <- response
+	})
+	return results
+}
+
+// streamBatch fans the jobs out over the worker pool and writes each result
+// as an NDJSON line. If the client disconnects the request context is
+// cancelled, which makes the workers skip whatever hasn't started yet.
+func streamBatch(w http.ResponseWriter, r *http.Request, jobs []Job) {
+	ctx := r.Context()
+	logger := requestLogger(ctx)
+	flusher, canFlush := w.(http.Flusher)
+
+	logger.Info("Streaming batch", "videos", len(jobs))
+
+	results := fanOutBatch(ctx, jobs)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+
+	for range jobs {
+		select {
+		case result := <-results:
+			if err := encoder.Encode(newVideoResult(result)); err != nil {
+				logger.Warn("Failed to write batch result", "video_id", result.VideoID, "error", err)
+				return
+			}
+			if canFlush {
+				flusher.Flush()
+			}
+		case <-ctx.Done():
+			logger.Info("Client disconnected, abandoning remaining batch results")
+			return
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxAsyncBatchSize caps batches submitted with async=true. They don't hold a
+// connection open, so they may be much larger than synchronous ones.
+const maxAsyncBatchSize = 1000
+
+// Page sizes for GET /transcript/batch/{job_id}
+const (
+	defaultBatchPageSize = 50
+	maxBatchPageSize     = 500
+)
+
+// batchJobTTL is how long a finished async batch stays retrievable, see
+// BATCH_JOB_TTL_SECONDS
+var batchJobTTL = time.Hour
+
+// BatchJobAccepted is returned when an async batch is submitted
+type BatchJobAccepted struct {
+	JobID     string `json:"job_id"`
+	Total     int    `json:"total"`
+	StatusURL string `json:"status_url"`
+}
+
+// Async batch states reported in BatchJobPage.Status
+const (
+	batchPending    = "pending"    // No video has finished yet
+	batchProcessing = "processing" // Some videos have finished
+	batchDone       = "done"       // Every video finished and at least one was checked
+	batchFailed     = "failed"     // Cancelled, or every video failed
+)
+
+// BatchJobPage is one page of an async batch's results. Results are listed in
+// completion order and only ever appended, so paging with offset is stable
+// while the batch is still running.
+type BatchJobPage struct {
+	JobID     string        `json:"job_id"`
+	Status    string        `json:"status"` // One of the batch* states
+	Progress  BatchProgress `json:"progress"`
+	Total     int           `json:"total"`
+	Completed int           `json:"completed"`
+	Done      bool          `json:"done"`
+	Cancelled bool          `json:"cancelled,omitempty"`
+	Offset    int           `json:"offset"`
+	Limit     int           `json:"limit"`
+	Results   []VideoResult `json:"results"`
+}
+
+// batchJob is an async batch and the results it has collected so far
+type batchJob struct {
+	id     string
+	total  int
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	results   []VideoResult
+	done      bool
+	cancelled bool
+	expiresAt time.Time // Set once done
+}
+
+// record adds a finished result unless the batch was cancelled meanwhile, so
+// nothing new shows up after a cancellation
+func (b *batchJob) record(result VideoResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.cancelled {
+		b.results = append(b.results, result)
+	}
+}
+
+// stop cancels the rest of the batch. Stopping a finished or already
+// cancelled batch changes nothing.
+func (b *batchJob) stop() {
+	b.mu.Lock()
+	if !b.done {
+		b.cancelled = true
+	}
+	b.mu.Unlock()
+	b.cancel()
+}
+
+// status sums the batch up as one of the batch* states. The caller holds mu.
+func (b *batchJob) status() string {
+	switch {
+	case b.cancelled:
+		return batchFailed
+	case b.done:
+		for _, result := range b.results {
+			if result.Error == "" {
+				return batchDone
+			}
+		}
+		if len(b.results) > 0 {
+			return batchFailed
+		}
+		return batchDone
+	case len(b.results) == 0:
+		return batchPending
+	}
+	return batchProcessing
+}
+
+// page returns up to limit results starting at offset
+func (b *batchJob) page(offset, limit int) BatchJobPage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := min(offset, len(b.results))
+	end := min(start+limit, len(b.results))
+	return BatchJobPage{
+		JobID:     b.id,
+		Status:    b.status(),
+		Progress:  BatchProgress{Completed: len(b.results), Total: b.total},
+		Total:     b.total,
+		Completed: len(b.results),
+		Done:      b.done,
+		Cancelled: b.cancelled,
+		Offset:    offset,
+		Limit:     limit,
+		Results:   append([]VideoResult{}, b.results[start:end]...),
+	}
+}
+
+// batchJobStore keeps async batches in memory until they expire
+type batchJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+var asyncBatches = &batchJobStore{jobs: make(map[string]*batchJob)}
+
+func (s *batchJobStore) add(job *batchJob) {
+	s.mu.Lock()
+	s.jobs[job.id] = job
+	s.mu.Unlock()
+}
+
+func (s *batchJobStore) get(id string) (*batchJob, bool) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	s.mu.Unlock()
+	return job, ok
+}
+
+// sweep drops finished batches whose TTL has passed
+func (s *batchJobStore) sweep() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := job.done && now.After(job.expiresAt)
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// startSweeper periodically removes expired batches
+func (s *batchJobStore) startSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.sweep()
+		}
+	}()
+}
+
+// startBatchJob runs the jobs in the background, see runBatch, and records
+// each result as it finishes. Once cancelled the rest never start and nothing
+// more is recorded. The batch outlives the request that submitted it but
+// keeps its request ID for logging.
+func startBatchJob(ctx context.Context, jobs []Job) *batchJob {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	batch := &batchJob{id: uuid.NewString(), total: len(jobs), cancel: cancel}
+	asyncBatches.add(batch)
+
+	go func() {
+		defer cancel()
+		runBatch(ctx, jobs, func(_ int, response TranscriptResponse) {
+			batch.record(newVideoResult(response))
+		})
+
+		batch.mu.Lock()
+		batch.done = true
+		batch.expiresAt = time.Now().Add(batchJobTTL)
+		batch.mu.Unlock()
+		requestLogger(ctx).Info("Async batch finished", "job_id", batch.id, "videos", batch.total)
+	}()
+	return batch
+}
+
+// acceptBatchJob starts an async batch and answers 202 with where to find it
+func acceptBatchJob(w http.ResponseWriter, r *http.Request, jobs []Job) {
+	batch := startBatchJob(r.Context(), jobs)
+	requestLogger(r.Context()).Info("Accepted async batch", "job_id", batch.id, "videos", batch.total)
+
+	statusURL := "/transcript/batch/" + batch.id
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(BatchJobAccepted{JobID: batch.id, Total: batch.total, StatusURL: statusURL})
+}
+
+// batchJobHandler returns a page of an async batch's results with
+// ?offset=&limit=. Poll while status is pending or processing, then read
+// every page.
+func batchJobHandler(w http.ResponseWriter, r *http.Request) {
+	batch, ok := asyncBatches.get(mux.Vars(r)["job_id"])
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Unknown or expired batch job")
+		return
+	}
+
+	offset, limit := 0, defaultBatchPageSize
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		var err error
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			writeJSONError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxBatchPageSize {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be an integer between 1 and %d", maxBatchPageSize))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.page(offset, limit))
+}
+
+// cancelBatchJobHandler stops an async batch and returns every result it
+// completed. Videos being checked are abandoned and the rest never start.
+// Cancelling again, or cancelling a finished batch, just returns the results.
+func cancelBatchJobHandler(w http.ResponseWriter, r *http.Request) {
+	batch, ok := asyncBatches.get(mux.Vars(r)["job_id"])
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Unknown or expired batch job")
+		return
+	}
+	batch.stop()
+	requestLogger(r.Context()).Info("Cancelled async batch", "job_id", batch.id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.page(0, batch.total))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// batchPage polls GET /transcript/batch/{job_id}
+func batchPage(t *testing.T, jobID string) BatchJobPage {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/transcript/batch/"+jobID+"?limit=500", nil), map[string]string{"job_id": jobID})
+	rec := httptest.NewRecorder()
+	batchJobHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var page BatchJobPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// waitForBatch polls until done reports true about the batch
+func waitForBatch(t *testing.T, jobID string, done func(BatchJobPage) bool) BatchJobPage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		page := batchPage(t, jobID)
+		if done(page) {
+			return page
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch never got there: %+v", page)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// submitAsyncBatch posts the videos as an async batch and returns its job ID
+func submitAsyncBatch(t *testing.T, videoIDs ...string) string {
+	t.Helper()
+	body, _ := json.Marshal(BatchRequest{VideoIDs: videoIDs})
+	rec := httptest.NewRecorder()
+	batchHandler(rec, httptest.NewRequest("POST", "/transcript/batch?async=true&no_cache=true", strings.NewReader(string(body))))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var accepted BatchJobAccepted
+	if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+		t.Fatal(err)
+	}
+	return accepted.JobID
+}
+
+func TestBatchJobStatus(t *testing.T) {
+	withoutFallbacks(t)
+	release := map[string]chan struct{}{"status00001": make(chan struct{}), "status00002": make(chan struct{})}
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		if wait, ok := release[videoID]; ok {
+			<-wait
+		}
+		if strings.HasPrefix(videoID, "broken") {
+			return nil, errNoCaptions
+		}
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "oh shit")}, nil
+	}))
+
+	jobID := submitAsyncBatch(t, "status00001", "status00002")
+	page := batchPage(t, jobID)
+	if page.Status != batchPending || page.Progress != (BatchProgress{Completed: 0, Total: 2}) || len(page.Results) != 0 {
+		t.Errorf("before anything finished: %+v", page)
+	}
+
+	close(release["status00001"])
+	page = waitForBatch(t, jobID, func(page BatchJobPage) bool { return page.Completed == 1 })
+	if page.Status != batchProcessing || page.Progress != (BatchProgress{Completed: 1, Total: 2}) || len(page.Results) != 1 {
+		t.Errorf("halfway: %+v", page)
+	}
+
+	close(release["status00002"])
+	page = waitForBatch(t, jobID, func(page BatchJobPage) bool { return page.Done })
+	if page.Status != batchDone || page.Progress != (BatchProgress{Completed: 2, Total: 2}) || len(page.Results) != 2 {
+		t.Errorf("finished: %+v", page)
+	}
+	if !page.Results[0].Profanity || page.Results[0].Error != "" {
+		t.Errorf("results not embedded: %+v", page.Results[0])
+	}
+
+	// One checked video is enough for the batch to be done
+	jobID = submitAsyncBatch(t, "broken00001", "fine0000001")
+	if page := waitForBatch(t, jobID, func(page BatchJobPage) bool { return page.Done }); page.Status != batchDone {
+		t.Errorf("partly failed batch status = %q, want %q", page.Status, batchDone)
+	}
+
+	jobID = submitAsyncBatch(t, "broken00001", "broken00002")
+	page = waitForBatch(t, jobID, func(page BatchJobPage) bool { return page.Done })
+	if page.Status != batchFailed || page.Progress != (BatchProgress{Completed: 2, Total: 2}) || page.Results[0].Error == "" {
+		t.Errorf("every video failed: %+v", page)
+	}
+}
+
+func TestCancelledBatchJobFailed(t *testing.T) {
+	withoutFallbacks(t)
+	release := make(chan struct{})
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		<-release
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello")}, nil
+	}))
+	defer close(release)
+
+	jobID := submitAsyncBatch(t, "cancelst001")
+	batch, _ := asyncBatches.get(jobID)
+	batch.stop()
+	if page := batchPage(t, jobID); page.Status != batchFailed || !page.Cancelled {
+		t.Errorf("cancelled batch: %+v", page)
+	}
+}
+
+func TestCancelBatchJobStopsResults(t *testing.T) {
+	withoutFallbacks(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		fetches.Add(1)
+		if videoID != "cancel00000" {
+			<-release // Everything else is still being checked when the batch is cancelled
+		}
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "oh shit")}, nil
+	}))
+	released := false
+	t.Cleanup(func() {
+		if !released {
+			close(release)
+		}
+	})
+
+	var batch BatchRequest
+	for i := 0; i < 4*maxWorkers; i++ {
+		batch.VideoIDs = append(batch.VideoIDs, fmt.Sprintf("cancel%05d", i))
+	}
+	body, _ := json.Marshal(batch)
+	rec := httptest.NewRecorder()
+	batchHandler(rec, httptest.NewRequest("POST", "/transcript/batch?async=true&no_cache=true", strings.NewReader(string(body))))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var accepted BatchJobAccepted
+	if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+		t.Fatal(err)
+	}
+	waitForBatch(t, accepted.JobID, func(page BatchJobPage) bool { return page.Completed == 1 })
+
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/transcript/batch/"+accepted.JobID, nil), map[string]string{"job_id": accepted.JobID})
+	rec = httptest.NewRecorder()
+	cancelBatchJobHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel status = %d: %s", rec.Code, rec.Body)
+	}
+	var cancelled BatchJobPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled.Cancelled || len(cancelled.Results) != 1 || cancelled.Results[0].VideoID != "cancel00000" {
+		t.Fatalf("cancel returned %+v, want the one finished result", cancelled)
+	}
+
+	// The batch finishes without waiting for the checks still running
+	page := waitForBatch(t, accepted.JobID, func(page BatchJobPage) bool { return page.Done })
+	if page.Completed != 1 || !page.Cancelled {
+		t.Errorf("after cancelling: completed = %d, cancelled = %v", page.Completed, page.Cancelled)
+	}
+
+	// Let the abandoned checks finish, they mustn't show up
+	started := fetches.Load()
+	close(release)
+	released = true
+	time.Sleep(20 * time.Millisecond)
+	if got := fetches.Load(); got != started {
+		t.Errorf("%d videos were fetched after cancelling", got-started)
+	}
+	if page := batchPage(t, accepted.JobID); page.Completed != 1 {
+		t.Errorf("completed = %d after the batch finished", page.Completed)
+	}
+}
+
+func TestCancelUnknownBatchJob(t *testing.T) {
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/transcript/batch/nope", nil), map[string]string{"job_id": "nope"})
+	rec := httptest.NewRecorder()
+	cancelBatchJobHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BatchProgress counts finished videos. It is the final event of a batch
+// event stream and part of every async batch page.
+type BatchProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// batchEventsHandler streams batch results as Server-Sent Events so browser
+// UIs can show progress with EventSource. Videos are given as ?ids=a,b,c
+// (IDs or URLs) with an optional shared ?lang=, and take the same scan
+// options as the other endpoints. Each finished video is a "result" event
+// carrying its JSON result, in completion order, and a final "done" event
+// closes the stream.
+func batchEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			req.VideoIDs = append(req.VideoIDs, id)
+		}
+	}
+	req.Lang = r.URL.Query().Get("lang")
+
+	options, err := parseScanOptions(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkDictionary(w, r) {
+		return
+	}
+	jobs, err := batchJobs(req, options)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(jobs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "The ids parameter must list at least one video")
+		return
+	}
+	if len(jobs) > maxBatchSize {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Batch size %d exceeds the maximum of %d", len(jobs), maxBatchSize))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	ctx := r.Context()
+	logger := requestLogger(ctx)
+	logger.Info("Streaming batch events", "videos", len(jobs))
+	results := fanOutBatch(ctx, jobs)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for completed := 1; completed <= len(jobs); completed++ {
+		select {
+		case result := <-results:
+			if err := writeEvent(w, "result", newVideoResult(result)); err != nil {
+				logger.Warn("Failed to write batch event", "video_id", result.VideoID, "error", err)
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			logger.Info("Client disconnected, abandoning remaining batch events")
+			return
+		}
+	}
+	writeEvent(w, "done", BatchProgress{Completed: len(jobs), Total: len(jobs)})
+	flusher.Flush()
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload. encoding/json
+// never emits raw newlines, so the payload always fits on one data line.
+func writeEvent(w http.ResponseWriter, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
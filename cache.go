@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultStore is where computed results are cached, see resultCache and
+// sqliteCache. Successful results are stored for the cache's TTL and videos
+// without a transcript for its shorter negative TTL, see entryTTL. Other
+// failures are never stored.
+type resultStore interface {
+	get(key string) (TranscriptResponse, bool)
+	set(key string, response TranscriptResponse)
+}
+
+// resultCache keeps computed results in memory so repeated checks of the same
+// video don't go back to YouTube
+type resultCache struct {
+	mu          sync.RWMutex
+	entries     map[string]cacheEntry
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+type cacheEntry struct {
+	response  TranscriptResponse
+	expiresAt time.Time
+}
+
+// Results cache, nil when caching is disabled (CACHE_TTL_SECONDS=0). Kept in
+// memory unless CACHE_DB points at a SQLite file.
+var cache resultStore
+
+func newResultCache(ttl, negativeTTL time.Duration) *resultCache {
+	return &resultCache{
+		entries:     make(map[string]cacheEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+// get returns a cached result if one exists and hasn't expired
+func (c *resultCache) get(key string) (TranscriptResponse, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return TranscriptResponse{}, false
+	}
+	return entry.response, true
+}
+
+// set stores a result for the cache's TTL, or its negative TTL if the video
+// had no transcript
+func (c *resultCache) set(key string, response TranscriptResponse) {
+	ttl := entryTTL(response, c.ttl, c.negativeTTL)
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{response: response, expiresAt: time.Now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+// sweep drops expired entries so the map doesn't grow without bound
+func (c *resultCache) sweep() {
+	now := time.Now()
+	c.mu.Lock()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// startSweeper periodically removes expired entries
+func (c *resultCache) startSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.sweep()
+		}
+	}()
+}
+
+// negativeResults are the failures worth caching: the video had nothing to
+// scan when we looked. Captions may still show up later, auto-captions take
+// a while, so these are kept for the shorter negative TTL. Transient
+// failures like throttling or timeouts are never cached.
+var negativeResults = []error{errNoCaptions, errCaptionKindMissing, errEmptyTranscript, errPrivateVideo, errVideoUnavailable}
+
+// negativeResult returns which of negativeResults a failed check ended in
+func negativeResult(err error) (error, bool) {
+	for _, negative := range negativeResults {
+		if errors.Is(err, negative) {
+			return negative, true
+		}
+	}
+	return nil, false
+}
+
+// entryTTL is how long a result is kept, 0 for not at all
+func entryTTL(response TranscriptResponse, ttl, negativeTTL time.Duration) time.Duration {
+	if response.Error == "" {
+		return ttl
+	}
+	if _, ok := negativeResult(response.Err); ok {
+		return negativeTTL
+	}
+	return 0
+}
+
+// cacheKey identifies a result by video, languages, the options that change
+// what gets scanned, and the dictionary version so a different word list never
+// serves stale verdicts
+func cacheKey(job Job) string {
+	// no_cache only decides whether the cache is used, so such jobs still
+	// share in-flight work with identical ones
+	options := job.Options
+	options.NoCache = false
+	return fmt.Sprintf("%s|%s|%+v|%s",
+		job.VideoID,
+		strings.Join(job.Languages, ","),
+		options,
+		currentDictionary().version,
+	)
+}
+
+// neverCachePatterns lists video IDs whose results are never cached, such as
+// ongoing streams or videos that keep being re-edited. Entries may use
+// path.Match wildcards. Set with NO_CACHE_VIDEOS, comma separated.
+var neverCachePatterns []string
+
+// parseNeverCachePatterns reads the NO_CACHE_VIDEOS format
+func parseNeverCachePatterns(raw string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(raw, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// skipsCache reports whether a job's result must neither come from nor go
+// into the cache, because the client asked for no_cache or the video is
+// listed in neverCachePatterns. Such jobs still go through the worker pool
+// and its rate limiting like any other.
+func skipsCache(job Job) bool {
+	if job.Options.NoCache {
+		return true
+	}
+	for _, pattern := range neverCachePatterns {
+		if matched, _ := path.Match(pattern, job.VideoID); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteCache keeps results in a SQLite file so they survive restarts. Rows
+// hold the full response for serving hits, plus the video, languages and
+// verdict as plain columns for inspecting the cache by hand.
+type sqliteCache struct {
+	db          *sql.DB
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// sqliteEntry is what the response column holds. Err isn't part of the JSON
+// response, so negative results keep which of negativeResults they were in
+// ErrorKind to pick the same status code when served from the cache.
+type sqliteEntry struct {
+	TranscriptResponse
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+const sqliteCacheSchema = `
+CREATE TABLE IF NOT EXISTS results (
+	key        TEXT PRIMARY KEY,
+	video_id   TEXT NOT NULL,
+	lang       TEXT NOT NULL,
+	profanity  INTEGER NOT NULL,
+	response   TEXT NOT NULL,
+	checked_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_expires_at ON results (expires_at);
+`
+
+// openSQLiteCache opens (creating if needed) the cache database at path
+func openSQLiteCache(path string, ttl, negativeTTL time.Duration) (*sqliteCache, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, let database/sql queue for it
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteCacheSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteCache{db: db, ttl: ttl, negativeTTL: negativeTTL}, nil
+}
+
+// get returns a cached result if one exists and hasn't expired
+func (c *sqliteCache) get(key string) (TranscriptResponse, bool) {
+	var raw string
+	err := c.db.QueryRow(`SELECT response FROM results WHERE key = ? AND expires_at > ?`,
+		key, time.Now().Unix()).Scan(&raw)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warn("Cache read failed", "error", err)
+		}
+		return TranscriptResponse{}, false
+	}
+	var entry sqliteEntry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		slog.Warn("Ignoring unreadable cache entry", "error", err)
+		return TranscriptResponse{}, false
+	}
+	for _, negative := range negativeResults {
+		if entry.ErrorKind == negative.Error() {
+			entry.Err = negative
+		}
+	}
+	return entry.TranscriptResponse, true
+}
+
+// set stores a result for the cache's TTL, or its negative TTL if the video
+// had no transcript. Failures are logged and otherwise ignored, the result is
+// simply fetched again next time.
+func (c *sqliteCache) set(key string, response TranscriptResponse) {
+	ttl := entryTTL(response, c.ttl, c.negativeTTL)
+	if ttl <= 0 {
+		return
+	}
+	entry := sqliteEntry{TranscriptResponse: response}
+	if negative, ok := negativeResult(response.Err); ok {
+		entry.ErrorKind = negative.Error()
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		slog.Warn("Cache write failed", "video_id", response.VideoID, "error", err)
+		return
+	}
+	now := time.Now()
+	_, err = c.db.Exec(`INSERT OR REPLACE INTO results
+		(key, video_id, lang, profanity, response, checked_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key, response.VideoID, response.Language, response.Profanity, string(raw), now.Unix(), now.Add(ttl).Unix())
+	if err != nil {
+		slog.Warn("Cache write failed", "video_id", response.VideoID, "error", err)
+	}
+}
+
+// sweep deletes expired rows
+func (c *sqliteCache) sweep() {
+	if _, err := c.db.Exec(`DELETE FROM results WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		slog.Warn("Cache sweep failed", "error", err)
+	}
+}
+
+// startSweeper periodically removes expired rows
+func (c *sqliteCache) startSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.sweep()
+		}
+	}()
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+	"golang.org/x/time/rate"
+)
+
+// countingFetcher serves a clean transcript and counts the fetches
+func countingFetcher(fetches *atomic.Int32) fetcherFunc {
+	return func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		fetches.Add(1)
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}
+}
+
+// withTestCache swaps in an empty in-memory cache for the rest of the test
+func withTestCache(t *testing.T) *resultCache {
+	previous := cache
+	memory := newResultCache(time.Hour, time.Hour)
+	cache = memory
+	t.Cleanup(func() { cache = previous })
+	return memory
+}
+
+func TestNoCacheNeitherReadsNorWritesCache(t *testing.T) {
+	withoutFallbacks(t)
+	memory := withTestCache(t)
+	var fetches atomic.Int32
+	startTestWorkers(t, countingFetcher(&fetches))
+
+	job := Job{VideoID: "nocache0001", Languages: []string{"en"}, Options: defaultScanOptions()}
+	job.Options.NoCache = true
+	if response := runJob(job); response.Error != "" || response.Cached {
+		t.Fatalf("response = %+v", response)
+	}
+	if _, ok := memory.get(cacheKey(job)); ok {
+		t.Error("no_cache result was written to the cache")
+	}
+
+	// A normal check caches the result, which no_cache then ignores
+	job.Options.NoCache = false
+	runJob(job)
+	job.Options.NoCache = true
+	if response := runJob(job); response.Cached {
+		t.Error("no_cache result was served from the cache")
+	}
+	if got := fetches.Load(); got != 3 {
+		t.Errorf("fetches = %d, want 3", got)
+	}
+
+	job.Options.NoCache = false
+	if response := runJob(job); !response.Cached {
+		t.Error("normal check missed the cache")
+	}
+	if got := fetches.Load(); got != 3 {
+		t.Errorf("fetches = %d after a cache hit, want 3", got)
+	}
+}
+
+func TestNoCacheQueryParameter(t *testing.T) {
+	withoutFallbacks(t)
+	withTestCache(t)
+	var fetches atomic.Int32
+	startTestWorkers(t, countingFetcher(&fetches))
+
+	for _, want := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=nocache0002", nil))
+		if got := rec.Header().Get("X-Cache"); got != want {
+			t.Fatalf("X-Cache = %q, want %q", got, want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=nocache0002&no_cache=true", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("status = %d, X-Cache = %q, want a fresh result", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+
+	rec = httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=nocache0002&no_cache=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for an invalid no_cache, want 400", rec.Code)
+	}
+}
+
+func TestNoCacheAppliesToEveryEndpoint(t *testing.T) {
+	withoutFallbacks(t)
+	var fetches atomic.Int32
+	startTestWorkers(t, countingFetcher(&fetches))
+
+	// Each checks two videos with the query string given, no_cache included
+	endpoints := map[string]func(query string) *httptest.ResponseRecorder{
+		"batch": func(query string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			batchHandler(rec, httptest.NewRequest("POST", "/transcript/batch?"+query, strings.NewReader(`{"video_ids":["nocache0101","nocache0102"]}`)))
+			return rec
+		},
+		"stream": func(query string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			batchEventsHandler(rec, httptest.NewRequest("GET", "/transcript/batch/stream?ids=nocache0201,nocache0202&"+query, nil))
+			return rec
+		},
+		"compare": func(query string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			compareHandler(rec, httptest.NewRequest("GET", "/compare?a=nocache0301&b=nocache0302&"+query, nil))
+			return rec
+		},
+		"graphql": func(query string) *httptest.ResponseRecorder {
+			noCache := strings.Contains(query, "no_cache=true")
+			body := fmt.Sprintf(`{"query":"{ a: profanity(videoId: \"nocache0401\", options: {noCache: %[1]v}) { profane } b: profanity(videoId: \"nocache0402\", options: {noCache: %[1]v}) { profane } }"}`, noCache)
+			rec := httptest.NewRecorder()
+			graphqlHandler(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+			return rec
+		},
+	}
+	for name, check := range endpoints {
+		t.Run(name, func(t *testing.T) {
+			withTestCache(t)
+			fetches.Store(0)
+			for _, step := range []struct {
+				query string
+				want  int32 // Total fetches afterwards
+			}{
+				{"no_cache=true", 2},
+				{"no_cache=true", 4},  // Nothing read from the cache
+				{"no_cache=false", 6}, // Nothing written to it either
+				{"no_cache=false", 6},
+			} {
+				if rec := check(step.query); rec.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d: %s", step.query, rec.Code, rec.Body)
+				}
+				if got := fetches.Load(); got != step.want {
+					t.Fatalf("after %s: fetches = %d, want %d", step.query, got, step.want)
+				}
+			}
+			if name != "graphql" {
+				if rec := check("no_cache=maybe"); rec.Code != http.StatusBadRequest {
+					t.Errorf("status = %d for an invalid no_cache, want 400", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestNoCacheRespectsRateLimit(t *testing.T) {
+	withoutFallbacks(t)
+	memory := withTestCache(t)
+	var fetches atomic.Int32
+	startTestWorkers(t, countingFetcher(&fetches))
+	previous := rateLimiter
+	rateLimiter = rate.NewLimiter(0, 0) // Never allows a request
+	t.Cleanup(func() { rateLimiter = previous })
+
+	job := Job{VideoID: "nocache0003", Languages: []string{"en"}, Options: defaultScanOptions()}
+	memory.set(cacheKey(job), TranscriptResponse{VideoID: job.VideoID})
+	if response := runJob(job); !response.Cached {
+		t.Fatal("cached result not served")
+	}
+	job.Options.NoCache = true
+	if response := runJob(job); response.Error == "" {
+		t.Error("no_cache check got past the rate limiter")
+	}
+	if got := fetches.Load(); got != 0 {
+		t.Errorf("fetches = %d, want 0", got)
+	}
+}
+
+func TestNeverCachePatterns(t *testing.T) {
+	patterns, err := parseNeverCachePatterns(" liveStream1 , stream*, ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := neverCachePatterns
+	neverCachePatterns = patterns
+	t.Cleanup(func() { neverCachePatterns = previous })
+
+	for videoID, want := range map[string]bool{
+		"liveStream1": true,
+		"streamABCDE": true,
+		"dQw4w9WgXcQ": false,
+	} {
+		if got := skipsCache(Job{VideoID: videoID}); got != want {
+			t.Errorf("skipsCache(%s) = %v, want %v", videoID, got, want)
+		}
+	}
+	if _, err := parseNeverCachePatterns("abc["); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+}
+
+func TestNeverCacheVideoIsNotCached(t *testing.T) {
+	withoutFallbacks(t)
+	memory := withTestCache(t)
+	previous := neverCachePatterns
+	neverCachePatterns = []string{"nocache0004"}
+	t.Cleanup(func() { neverCachePatterns = previous })
+	var fetches atomic.Int32
+	startTestWorkers(t, countingFetcher(&fetches))
+
+	job := Job{VideoID: "nocache0004", Languages: []string{"en"}, Options: defaultScanOptions()}
+	runJob(job)
+	runJob(job)
+	if _, ok := memory.get(cacheKey(job)); ok {
+		t.Error("listed video was cached")
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestNegativeEntriesExpireOnTheirOwnTTL(t *testing.T) {
+	memory := newResultCache(time.Hour, 20*time.Millisecond)
+	memory.set("found", TranscriptResponse{VideoID: "found"})
+	memory.set("missing", TranscriptResponse{VideoID: "missing", Error: "No captions", Err: errNoCaptions})
+	memory.set("throttled", TranscriptResponse{VideoID: "throttled", Error: "Throttled", Err: errYouTubeThrottled})
+
+	if _, ok := memory.get("missing"); !ok {
+		t.Fatal("negative result not cached")
+	}
+	if _, ok := memory.get("throttled"); ok {
+		t.Error("transient failure was cached")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := memory.get("missing"); ok {
+		t.Error("negative result outlived its TTL")
+	}
+	if _, ok := memory.get("found"); !ok {
+		t.Error("successful result expired with the negative TTL")
+	}
+
+	memory = newResultCache(time.Hour, 0)
+	memory.set("missing", TranscriptResponse{VideoID: "missing", Error: "No captions", Err: errNoCaptions})
+	if _, ok := memory.get("missing"); ok {
+		t.Error("negative result cached with a negative TTL of 0")
+	}
+}
+
+func TestSQLiteCacheNegativeTTL(t *testing.T) {
+	db, err := openSQLiteCache(filepath.Join(t.TempDir(), "cache.db"), time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.db.Close() })
+
+	db.set("found", TranscriptResponse{VideoID: "found"})
+	db.set("private", TranscriptResponse{VideoID: "private", Error: "Video is private", Err: fmt.Errorf("%w: login required", errPrivateVideo)})
+	db.set("throttled", TranscriptResponse{VideoID: "throttled", Error: "Throttled", Err: errYouTubeThrottled})
+
+	for key, want := range map[string]int64{"found": 3600, "private": 60} {
+		var ttl int64
+		if err := db.db.QueryRow(`SELECT expires_at - checked_at FROM results WHERE key = ?`, key).Scan(&ttl); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if ttl != want {
+			t.Errorf("%s kept for %ds, want %ds", key, ttl, want)
+		}
+	}
+	if _, ok := db.get("throttled"); ok {
+		t.Error("transient failure was cached")
+	}
+	// The kind of failure survives the round trip, so hits get the same status
+	response, ok := db.get("private")
+	if !ok || errorStatusCode(response.Err) != http.StatusForbidden {
+		t.Errorf("cached negative result = %+v, %v", response, ok)
+	}
+}
+
+func TestNegativeResultServedFromCache(t *testing.T) {
+	withoutFallbacks(t)
+	noRetrySleep(t)
+	previous := cache
+	cache = newResultCache(time.Hour, 50*time.Millisecond)
+	t.Cleanup(func() { cache = previous })
+	var fetches atomic.Int32
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		fetches.Add(1)
+		return nil, errors.New("no transcript found for language en")
+	}))
+
+	// The second request is answered from the cache
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=negative001", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("request %d: status = %d, want 404: %s", i, rec.Code, rec.Body)
+		}
+		if got := fetches.Load(); got != 1 {
+			t.Errorf("request %d: fetches = %d, want 1", i, got)
+		}
+	}
+
+	// Captions may have been added since, so the video is checked again
+	time.Sleep(70 * time.Millisecond)
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=negative001", nil))
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d after the negative TTL, want 2", got)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientIdleTimeout is how long a client's bucket is kept after its last
+// request. A bucket idle that long has refilled anyway.
+const clientIdleTimeout = 10 * time.Minute
+
+// trustedProxyHops is how many proxies in front of the server append to
+// X-Forwarded-For, see TRUSTED_PROXY_HOPS. With 0 the header is ignored since
+// anyone can send it.
+var trustedProxyHops = 0
+
+// clientBucket is one client's token bucket
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// clientLimiter rate-limits requests per client IP so one client can't take
+// up the whole worker pool
+type clientLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*clientBucket
+}
+
+func newClientLimiter(perMinute, burst int) *clientLimiter {
+	return &clientLimiter{
+		limit:   rate.Limit(float64(perMinute) / 60),
+		burst:   burst,
+		clients: make(map[string]*clientBucket),
+	}
+}
+
+// reserve takes a token for ip, returning how long the client has to wait
+// when there is none left
+func (c *clientLimiter) reserve(ip string) (time.Duration, bool) {
+	now := time.Now()
+	c.mu.Lock()
+	bucket, ok := c.clients[ip]
+	if !ok {
+		bucket = &clientBucket{limiter: rate.NewLimiter(c.limit, c.burst)}
+		c.clients[ip] = bucket
+	}
+	bucket.lastSeen = now
+	c.mu.Unlock()
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// Don't spend a future token on a rejected request
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// sweep forgets clients that have been idle for clientIdleTimeout
+func (c *clientLimiter) sweep() {
+	cutoff := time.Now().Add(-clientIdleTimeout)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ip, bucket := range c.clients {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(c.clients, ip)
+		}
+	}
+}
+
+// startSweeper periodically removes idle clients
+func (c *clientLimiter) startSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.sweep()
+		}
+	}()
+}
+
+// clientLimitMiddleware answers 429 with Retry-After once a client IP runs
+// out of tokens. Public paths such as health checks are never limited. A nil
+// limiter disables the middleware.
+func clientLimitMiddleware(limiter *clientLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := clientIP(r)
+			if wait, ok := limiter.reserve(ip); !ok {
+				requestLogger(r.Context()).Warn("Client rate limit exceeded", "client_ip", ip, "path", r.URL.Path)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeJSONError(w, http.StatusTooManyRequests, "Too many requests, please slow down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the address the request came from. Behind trustedProxyHops
+// proxies it is the entry that many places from the end of X-Forwarded-For,
+// since each proxy appends the address it saw and anything earlier could
+// have been sent by the client.
+func clientIP(r *http.Request) string {
+	if trustedProxyHops > 0 {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					forwarded = append(forwarded, entry)
+				}
+			}
+		}
+		if len(forwarded) >= trustedProxyHops {
+			return forwarded[len(forwarded)-trustedProxyHops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
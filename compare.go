@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+)
+
+// CompareSummary describes how the two videos differ
+type CompareSummary struct {
+	MoreProfane     string  `json:"more_profane"`     // "a", "b" or "equal"
+	ScoreDifference float64 `json:"score_difference"` // Absolute difference in severity score
+}
+
+// CompareResponse structure for the compare endpoint
+type CompareResponse struct {
+	A       VideoResult     `json:"a"`
+	B       VideoResult     `json:"b"`
+	Summary *CompareSummary `json:"summary,omitempty"` // Omitted if either video failed
+}
+
+// compareHandler checks two videos side by side. Both go through the
+// regular worker pool so the rate limiter applies to each fetch.
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("a") == "" || query.Get("b") == "" {
+		writeJSONError(w, http.StatusBadRequest, "Both a and b video IDs are required")
+		return
+	}
+	videoA, errA := extractVideoID(query.Get("a"))
+	videoB, errB := extractVideoID(query.Get("b"))
+	if errA != nil || errB != nil {
+		writeJSONError(w, http.StatusBadRequest, "a and b must be YouTube video IDs or URLs")
+		return
+	}
+
+	languages := requestLanguages(r)
+	options, err := parseScanOptions(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !checkDictionary(w, r) {
+		return
+	}
+
+	requestLogger(r.Context()).Info("Comparing videos", "video_a", videoA, "video_b", videoB, "lang", languages)
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	var response CompareResponse
+	var wg sync.WaitGroup
+	for _, side := range []struct {
+		videoID string
+		entry   *VideoResult
+	}{{videoA, &response.A}, {videoB, &response.B}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runJob(Job{Ctx: ctx, VideoID: side.videoID, Languages: languages, Options: options})
+			*side.entry = newVideoResult(result)
+		}()
+	}
+	wg.Wait()
+
+	if response.A.Error == "" && response.B.Error == "" {
+		response.Summary = compareResults(response.A.TranscriptResponse, response.B.TranscriptResponse)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	json.NewEncoder(w).Encode(response)
+}
+
+// compareResults works out which of two results is more profane
+func compareResults(a, b TranscriptResponse) *CompareSummary {
+	summary := &CompareSummary{
+		MoreProfane:     "equal",
+		ScoreDifference: math.Round(math.Abs(a.SeverityScore-b.SeverityScore)*100) / 100,
+	}
+	if a.SeverityScore > b.SeverityScore {
+		summary.MoreProfane = "a"
+	} else if b.SeverityScore > a.SeverityScore {
+		summary.MoreProfane = "b"
+	}
+	return summary
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// compressMiddleware gzips or deflates responses for clients that accept it,
+// which mostly pays off for include_transcript and segment-heavy results.
+// Streaming responses are passed through untouched so every event reaches the
+// client when it's flushed instead of sitting in the compressor's buffer.
+func compressMiddleware(next http.Handler) http.Handler {
+	compressed := handlers.CompressHandler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		compressed.ServeHTTP(w, r)
+	})
+}
+
+// isStreamingRequest matches the SSE batch endpoint and NDJSON batches
+func isStreamingRequest(r *http.Request) bool {
+	return r.URL.Path == "/transcript/batch/stream" ||
+		r.URL.Query().Get("stream") == "true" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
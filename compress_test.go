@@ -0,0 +1,113 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// largeBody is big enough to be worth compressing
+var largeBody = strings.Repeat("what the fuck is this transcript ", 200)
+
+// serveCompressed sends req through compressMiddleware around a handler that
+// writes largeBody
+func serveCompressed(req *http.Request) *httptest.ResponseRecorder {
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, largeBody)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressMiddlewareGzip(t *testing.T) {
+	req := httptest.NewRequest("GET", "/transcript/dQw4w9WgXcQ", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serveCompressed(req)
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != largeBody {
+		t.Error("decompressed body differs")
+	}
+	if rec.Body.Len() >= len(largeBody) {
+		t.Errorf("compressed body is %d bytes, plain %d", rec.Body.Len(), len(largeBody))
+	}
+}
+
+func TestCompressMiddlewareDeflate(t *testing.T) {
+	req := httptest.NewRequest("GET", "/transcript/dQw4w9WgXcQ", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	rec := serveCompressed(req)
+	if got := rec.Header().Get("Content-Encoding"); got != "deflate" {
+		t.Fatalf("Content-Encoding = %q, want deflate", got)
+	}
+	body, err := io.ReadAll(flate.NewReader(rec.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != largeBody {
+		t.Error("decompressed body differs")
+	}
+}
+
+func TestCompressMiddlewarePlain(t *testing.T) {
+	rec := serveCompressed(httptest.NewRequest("GET", "/transcript/dQw4w9WgXcQ", nil))
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q without Accept-Encoding", got)
+	}
+	if rec.Body.String() != largeBody {
+		t.Error("plain body differs")
+	}
+}
+
+func TestCompressMiddlewareSkipsStreaming(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{"server-sent events endpoint", "/transcript/batch/stream?ids=a", ""},
+		{"ndjson batch", "/transcript/batch?stream=true", ""},
+		{"event-stream accept header", "/transcript/batch", "text/event-stream"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := serveCompressed(req)
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q on a streaming response", got)
+			}
+			if rec.Body.String() != largeBody {
+				t.Error("streamed body differs")
+			}
+		})
+	}
+}
+
+func TestCompressMiddlewareKeepsFlusher(t *testing.T) {
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("streaming handler lost http.Flusher")
+		}
+	}))
+	req := httptest.NewRequest("GET", "/transcript/batch/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings read from the environment at startup
+type Config struct {
+	Port       string        // PORT, default 8080
+	MaxWorkers int           // MAX_WORKERS, default 5
+	RateLimit  time.Duration // RATE_LIMIT_MS, average gap between YouTube requests, default 2000
+	RateBurst  int           // RATE_LIMIT_BURST, requests allowed back to back, defaults to MaxWorkers
+	// MAX_OUTBOUND_REQUESTS, YouTube requests in flight at once, defaults to
+	// MaxWorkers. The rate limit governs how often requests may start, this
+	// how many may be running; every request has to get past both. Language
+	// listings count against it too, not just worker fetches.
+	MaxOutbound int
+}
+
+// loadConfig reads the server settings from the environment, applying
+// defaults for anything unset. Non-numeric or non-positive values are fatal.
+func loadConfig() Config {
+	port := envPositiveInt("PORT", 8080)
+	if port > 65535 {
+		fatal("Invalid value for PORT: out of range", "value", port)
+	}
+	workers := envPositiveInt("MAX_WORKERS", 5)
+	return Config{
+		Port:        strconv.Itoa(port),
+		MaxWorkers:  workers,
+		RateLimit:   time.Duration(envPositiveInt("RATE_LIMIT_MS", 2000)) * time.Millisecond,
+		RateBurst:   envPositiveInt("RATE_LIMIT_BURST", workers),
+		MaxOutbound: envPositiveInt("MAX_OUTBOUND_REQUESTS", workers),
+	}
+}
+
+// envPositiveInt is envInt for settings where zero or a negative number
+// makes no sense
+func envPositiveInt(name string, def int) int {
+	value := envInt(name, def)
+	if value <= 0 {
+		fatal("Invalid value: must be greater than zero", "name", name, "value", value)
+	}
+	return value
+}
+
+// envInt reads an integer from the environment, falling back to def when the
+// variable is unset. A value that does not parse is treated as fatal so a typo
+// in deployment config doesn't silently fall back to the default.
+func envInt(name string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		fatal("Invalid value: not a number", "name", name, "value", raw)
+	}
+	return value
+}
+
+// envString reads a string from the environment, falling back to def when the
+// variable is unset or blank.
+func envString(name string, def string) string {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	return raw
+}
+
+// envFloat reads a floating point number from the environment, falling back
+// to def when the variable is unset. Unparseable values are fatal.
+func envFloat(name string, def float64) float64 {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		fatal("Invalid value: not a number", "name", name, "value", raw)
+	}
+	return value
+}
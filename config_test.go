@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	for _, name := range []string{"PORT", "MAX_WORKERS", "RATE_LIMIT_MS", "RATE_LIMIT_BURST", "MAX_OUTBOUND_REQUESTS"} {
+		t.Setenv(name, "")
+	}
+	want := Config{Port: "8080", MaxWorkers: 5, RateLimit: 2 * time.Second, RateBurst: 5, MaxOutbound: 5}
+	if got := loadConfig(); got != want {
+		t.Errorf("loadConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("MAX_WORKERS", " 12 ")
+	t.Setenv("RATE_LIMIT_MS", "250")
+	t.Setenv("RATE_LIMIT_BURST", "")
+	t.Setenv("MAX_OUTBOUND_REQUESTS", "3")
+	// The burst follows the worker count unless set
+	want := Config{Port: "9090", MaxWorkers: 12, RateLimit: 250 * time.Millisecond, RateBurst: 12, MaxOutbound: 3}
+	if got := loadConfig(); got != want {
+		t.Errorf("loadConfig() = %+v, want %+v", got, want)
+	}
+}
+
+// TestLoadConfigRejectsInvalid runs loadConfig in a child process, since
+// invalid values exit through fatal
+func TestLoadConfigRejectsInvalid(t *testing.T) {
+	if os.Getenv("LOAD_CONFIG_CHILD") == "1" {
+		loadConfig()
+		return
+	}
+	for name, value := range map[string]string{
+		"PORT":          "70000",
+		"MAX_WORKERS":   "0",
+		"RATE_LIMIT_MS": "fast",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestLoadConfigRejectsInvalid$")
+			cmd.Env = append(os.Environ(), "LOAD_CONFIG_CHILD=1", name+"="+value)
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				t.Errorf("%s=%s: err = %v, want exit status 1", name, value, err)
+			}
+		})
+	}
+}
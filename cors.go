@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// parseAllowedOrigins splits ALLOWED_ORIGINS into a list, "*" allows any
+// origin
+func parseAllowedOrigins(raw string) []string {
+	var origins []string
+	for _, origin := range strings.Split(raw, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return []string{"*"}
+	}
+	return origins
+}
+
+// corsHandler wraps h with CORS handling, answering preflight requests
+// itself. With the permissive "*" default any origin may call the API but
+// browsers won't send credentials; with an explicit origin list the request
+// origin is reflected back and credentialed requests are allowed.
+func corsHandler(h http.Handler, origins []string) http.Handler {
+	options := []handlers.CORSOption{
+		handlers.AllowedOrigins(origins),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "X-Requested-With", "Authorization", requestIDHeader}),
+		handlers.ExposedHeaders([]string{requestIDHeader, "X-Dictionary-Version", "X-Cache", "ETag", "Retry-After"}),
+	}
+	if len(origins) != 1 || origins[0] != "*" {
+		options = append(options, handlers.AllowCredentials())
+	}
+	return handlers.CORS(options...)(h)
+}
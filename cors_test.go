@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// corsRequest sends one request through corsHandler and reports whether it
+// reached the wrapped handler
+func corsRequest(origins []string, method, origin string, header http.Header) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	h := corsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}), origins)
+	req := httptest.NewRequest(method, "/transcript?url=dQw4w9WgXcQ", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec, reached
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	origins := []string{"https://app.example.com", "https://admin.example.com"}
+	rec, reached := corsRequest(origins, "GET", "https://admin.example.com", nil)
+	if !reached {
+		t.Fatal("request didn't reach the handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	exposed := strings.ToLower(rec.Header().Get("Access-Control-Expose-Headers"))
+	for _, header := range []string{requestIDHeader, "X-Dictionary-Version", "X-Cache", "ETag", "Retry-After"} {
+		if !strings.Contains(exposed, strings.ToLower(header)) {
+			t.Errorf("%s not exposed: %q", header, exposed)
+		}
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	rec, _ := corsRequest([]string{"https://app.example.com"}, "GET", "https://evil.example.com", nil)
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Expose-Headers"} {
+		if got := rec.Header().Get(header); got != "" {
+			t.Errorf("%s = %q for a disallowed origin", header, got)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	preflight := http.Header{
+		"Access-Control-Request-Method":  {"DELETE"}, // Simple methods like POST aren't listed back
+		"Access-Control-Request-Headers": {"Content-Type"},
+	}
+	rec, reached := corsRequest([]string{"https://app.example.com"}, "OPTIONS", "https://app.example.com", preflight)
+	if reached {
+		t.Error("preflight reached the handler")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "DELETE") {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Content-Type") {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+
+	rec, _ = corsRequest([]string{"https://app.example.com"}, "OPTIONS", "https://evil.example.com", preflight)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("preflight from a disallowed origin allowed: %q", got)
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	rec, reached := corsRequest(parseAllowedOrigins(""), "GET", "https://anywhere.example.com", nil)
+	if !reached {
+		t.Fatal("request didn't reach the handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q with the wildcard", got)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// debugEnabled turns on diagnostic endpoints that expose matcher internals.
+// They're off by default since they let anyone probe the dictionary.
+var debugEnabled = false
+
+// ScanVerdict is the outcome of one way of scanning a transcript
+type ScanVerdict struct {
+	Profanity      bool     `json:"profanity"`
+	ProfanityCount int      `json:"profanity_count"`
+	ProfaneWords   []string `json:"profane_words"`
+}
+
+// NormalizationComparison contrasts the verdict with only exact matching
+// against the one with the configured normalization steps (leetspeak,
+// elongation, inner punctuation, inflections and joined words)
+type NormalizationComparison struct {
+	Exact      ScanVerdict `json:"exact"`
+	Normalized ScanVerdict `json:"normalized"`
+	// Hits exact matching missed, positioned in the transcript as in
+	// match_offsets
+	NormalizationOnly []MatchOffset `json:"normalization_only"`
+}
+
+// compareNormalization scans text again with exact matching only and lists
+// the hits of normalized, the regular scan, that only normalization caught
+func compareNormalization(dict *dictionary, text string, normalized profanityMatches, options ScanOptions) *NormalizationComparison {
+	exactOptions := options.Match
+	exactOptions.Exact = true
+	exact := findProfanity(dict, text, exactOptions)
+
+	verdict := func(matches profanityMatches) ScanVerdict {
+		return ScanVerdict{
+			Profanity:      meetsThreshold(matches.hits, matches.density(), options.MinHits, options.MinDensity),
+			ProfanityCount: matches.hits,
+			ProfaneWords:   matches.words,
+		}
+	}
+	comparison := &NormalizationComparison{
+		Exact:             verdict(exact),
+		Normalized:        verdict(normalized),
+		NormalizationOnly: []MatchOffset{},
+	}
+	exactHits := make(map[[2]int]bool)
+	for _, offset := range exact.offsets() {
+		exactHits[[2]int{offset.Start, offset.End}] = true
+	}
+	for _, offset := range normalized.offsets() {
+		if !exactHits[[2]int{offset.Start, offset.End}] {
+			comparison.NormalizationOnly = append(comparison.NormalizationOnly, offset)
+		}
+	}
+	return comparison
+}
+
+// ExplainStep is one stage the matcher applied to a token
+type ExplainStep struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`
+}
+
+// ExplainResponse describes how a single word was treated by the scanner
+type ExplainResponse struct {
+	Word        string        `json:"word"`
+	Mode        string        `json:"mode"`
+	Steps       []ExplainStep `json:"steps"`
+	MatchedAs   string        `json:"matched_as,omitempty"` // Dictionary entry that was hit
+	Profane     bool          `json:"profane"`
+	DictVersion string        `json:"dict_version"`
+}
+
+// explainHandler runs one word through the same matching code the worker
+// uses and reports every step along the way
+func explainHandler(w http.ResponseWriter, r *http.Request) {
+	word := r.URL.Query().Get("word")
+	if word == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing word parameter")
+		return
+	}
+	options := defaultScanOptions().Match
+	if raw := r.URL.Query().Get("mode"); raw != "" {
+		mode, err := parseMatchMode(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		options.Mode = mode
+	}
+	options.Allow = parseAllowParam(r.URL.Query().Get("allow"))
+
+	dict := currentDictionary().forLanguage(r.URL.Query().Get("lang"))
+	response := ExplainResponse{Word: word, Mode: string(options.Mode), Steps: []ExplainStep{}, DictVersion: dict.version}
+	matched, ok := matchToken(dict, word, options, func(step, value string) {
+		response.Steps = append(response.Steps, ExplainStep{Step: step, Result: value})
+	})
+	if ok {
+		response.MatchedAs = matched
+		response.Profane = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxDebugTokens caps how many tokens the tokens endpoint returns
+const maxDebugTokens = 500
+
+// DebugToken is one token as produced by the scanner
+type DebugToken struct {
+	Index      int    `json:"index"`
+	Raw        string `json:"raw"`
+	Normalized string `json:"normalized"`
+	Profane    bool   `json:"profane"`
+}
+
+// TokensResponse lists the token stream for a piece of text
+type TokensResponse struct {
+	Tokens      []DebugToken `json:"tokens"`
+	TotalTokens int          `json:"total_tokens"`
+	Truncated   bool         `json:"truncated"`                   // Set when only the first maxDebugTokens are shown
+	Language    string       `json:"detected_language,omitempty"` // Detected when no lang is given, picks the word list
+}
+
+// tokensHandler shows how the scanner tokenizes text supplied in the text
+// query parameter or as a plain-text POST body
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("text")
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to read body")
+			return
+		}
+		text = string(body)
+	}
+	if text == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing text")
+		return
+	}
+
+	options := defaultScanOptions().Match
+	lang := r.URL.Query().Get("lang")
+	response := TokensResponse{}
+	if lang == "" && detectLanguageEnabled {
+		lang, _ = detectLanguage(text)
+		response.Language = lang
+	}
+	dict := currentDictionary().forLanguage(lang)
+	tokens := tokenize(text)
+	response.TotalTokens = len(tokens)
+	if len(tokens) > maxDebugTokens {
+		tokens = tokens[:maxDebugTokens]
+		response.Truncated = true
+	}
+
+	response.Tokens = make([]DebugToken, 0, len(tokens))
+	for i, token := range tokens {
+		normalized, profane := matchToken(dict, token, options, nil)
+		response.Tokens = append(response.Tokens, DebugToken{
+			Index:      i,
+			Raw:        token,
+			Normalized: normalized,
+			Profane:    profane,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// withNormalization turns on leetspeak and elongation handling for the rest
+// of the test
+func withNormalization(t *testing.T) {
+	previousLeet, previousElongation := normalizeLeetspeak, collapseElongation
+	normalizeLeetspeak, collapseElongation = true, true
+	t.Cleanup(func() { normalizeLeetspeak, collapseElongation = previousLeet, previousElongation })
+}
+
+func TestMatchTokenExact(t *testing.T) {
+	withNormalization(t)
+	dict := testDictionary(wordList{"shit": {}, "fuck": {}})
+	for token, want := range map[string]string{
+		"Shit!":  "shit", // Case and surrounding punctuation still count
+		"sh1t":   "",
+		"fuuuck": "",
+	} {
+		entry, ok := matchToken(dict, token, MatchOptions{Mode: MatchWord, Exact: true}, nil)
+		if ok != (want != "") || (ok && entry != want) {
+			t.Errorf("exact matchToken(%q) = %q, %v, want %q", token, entry, ok, want)
+		}
+		if _, ok := matchToken(dict, token, MatchOptions{Mode: MatchWord}, nil); !ok {
+			t.Errorf("normalized matchToken(%q) missed", token)
+		}
+	}
+}
+
+func TestCompareNormalization(t *testing.T) {
+	withoutFallbacks(t)
+	withNormalization(t)
+	previousDebug, previousDict := debugEnabled, currentDictionary()
+	setDictionary(testDictionary(wordList{"shit": {}, "fuck": {}, "damn": {}}))
+	t.Cleanup(func() {
+		debugEnabled = previousDebug
+		setDictionary(previousDict)
+	})
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "oh sh1t", "well damn", "fuuuck that")}, nil
+	}))
+
+	debugEnabled = false
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=compare0001&compare_normalization=true", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status without DEBUG = %d, want 400", rec.Code)
+	}
+
+	debugEnabled = true
+	rec = httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=compare0001&compare_normalization=true&min_hits=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response TranscriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	comparison := response.NormalizationComparison
+	if comparison == nil {
+		t.Fatalf("no comparison in %s", rec.Body)
+	}
+	// Only "damn" is spelled out, which is short of min_hits on its own
+	if comparison.Exact.Profanity || comparison.Exact.ProfanityCount != 1 || !slices.Equal(comparison.Exact.ProfaneWords, []string{"damn"}) {
+		t.Errorf("exact verdict = %+v", comparison.Exact)
+	}
+	if !comparison.Normalized.Profanity || comparison.Normalized.ProfanityCount != 3 || comparison.Normalized.Profanity != response.Profanity {
+		t.Errorf("normalized verdict = %+v, response profanity = %v", comparison.Normalized, response.Profanity)
+	}
+	var only []string
+	for _, offset := range comparison.NormalizationOnly {
+		only = append(only, offset.Word+"="+offset.Entry)
+	}
+	if !slices.Equal(only, []string{"sh1t=shit", "fuuuck=fuck"}) {
+		t.Errorf("normalization only = %v", only)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// dictionaryPath is an external word list loaded at startup and on reload
+// instead of the embedded one, see PROFANITY_FILE
+var dictionaryPath = ""
+
+// embeddedProfanityWords is the default word list, built into the binary so
+// it runs without companion files.
+//
+//go:embed eng.txt
+var embeddedProfanityWords string
+
+// languageDictionaryDir holds optional per-language word lists named after
+// the language code, e.g. profanity/es.txt. Transcripts in a language without
+// its own list are checked against the main dictionary.
+var languageDictionaryDir = "profanity"
+
+// allowlistPath lists words that are never flagged even when the dictionary
+// contains them, such as place names or medical terms. The file is optional.
+var allowlistPath = "allowlist.txt"
+
+// fallbackProfanityWords is a small built-in list used when PROFANITY_FILE
+// can't be loaded and strict mode is off.
+//
+//go:embed fallback_words.txt
+var fallbackProfanityWords string
+
+// Defaults for dictionary lines that only list the word
+const (
+	defaultWordCategory = "general"
+	defaultWordSeverity = 1
+)
+
+// How parseProfanityWords resolves an entry listed more than once, with
+// different classifications, see DUPLICATE_WORDS
+const (
+	duplicateHighest = "highest" // Keep the highest severity, whatever the line order
+	duplicateLast    = "last"    // Keep the last line
+)
+
+// duplicateWords is the policy for entries listed more than once. Other
+// overlaps are fixed: an allowlisted word is never flagged whatever its
+// severity, and a per-language list replaces the main list instead of
+// merging with it.
+var duplicateWords = duplicateHighest
+
+// wordInfo classifies a dictionary entry
+type wordInfo struct {
+	Category string
+	Severity int // Higher is worse
+}
+
+// wordList maps lowercase dictionary entries to their classification
+type wordList map[string]wordInfo
+
+// dictionary is a loaded word list. It is never modified after creation;
+// reloading builds a new one and swaps it in, so readers need no locking.
+type dictionary struct {
+	words     wordList
+	languages map[string]wordList // Per-language word lists, see languageDictionaryDir
+	allowed   wordList            // Entries suppressed at detection time, see allowlistPath
+	maxPhrase int                 // Words in the longest entry, phrase matching is skipped below 2
+	version   string              // See computeDictionaryVersion
+	source    string              // Where the words came from: "embedded", "file", "builtin" or "none"
+}
+
+// activeDictionary holds the dictionary used for new scans
+var activeDictionary atomic.Pointer[dictionary]
+
+// currentDictionary returns the dictionary new scans should use
+func currentDictionary() *dictionary {
+	return activeDictionary.Load()
+}
+
+// errDictionaryNotLoaded is the error detection requests get while the
+// dictionary is empty, which only happens with DICTIONARY_FALLBACK=none
+const errDictionaryNotLoaded = "Profanity dictionary is not loaded, please retry later"
+
+// dictionaryLoaded reports whether there are any words to detect
+func dictionaryLoaded() bool {
+	return len(currentDictionary().words) > 0
+}
+
+// setDictionary atomically replaces the active dictionary
+func setDictionary(dict *dictionary) {
+	activeDictionary.Store(dict)
+}
+
+func newDictionary(words wordList, source string) *dictionary {
+	dict := &dictionary{words: words, maxPhrase: maxPhraseLength(words), source: source}
+	dict.version = computeDictionaryVersion(dict)
+	return dict
+}
+
+// withAllowlist returns a copy of the dictionary that suppresses the given
+// words. The version changes with the allowlist since verdicts do too.
+func (d *dictionary) withAllowlist(allowed wordList) *dictionary {
+	dict := *d
+	dict.allowed = allowed
+	dict.version = computeDictionaryVersion(&dict)
+	return &dict
+}
+
+// withLanguages returns a copy of the dictionary with per-language word lists
+func (d *dictionary) withLanguages(languages map[string]wordList) *dictionary {
+	dict := *d
+	dict.languages = languages
+	dict.version = computeDictionaryVersion(&dict)
+	return &dict
+}
+
+// forLanguage returns the dictionary to scan a transcript in the given
+// language with. Regional variants fall back to their base language ("es-419"
+// uses es.txt), and languages without a list of their own use the main
+// dictionary.
+func (d *dictionary) forLanguage(lang string) *dictionary {
+	lang = strings.ToLower(lang)
+	words, ok := d.languages[lang]
+	if !ok {
+		base, _, _ := strings.Cut(lang, "-")
+		words, ok = d.languages[base]
+	}
+	if !ok {
+		return d
+	}
+	dict := *d
+	dict.words = words
+	dict.maxPhrase = maxPhraseLength(words)
+	return &dict
+}
+
+// loadMainDictionary loads the external word list when PROFANITY_FILE is set
+// and the embedded one otherwise
+func loadMainDictionary() (*dictionary, error) {
+	if dictionaryPath != "" {
+		return loadDictionaryFile(dictionaryPath)
+	}
+	words, err := parseProfanityWords(strings.NewReader(embeddedProfanityWords))
+	if err != nil {
+		return nil, err
+	}
+	return newDictionary(words, "embedded"), nil
+}
+
+// loadDictionaryFile reads a word list from disk
+func loadDictionaryFile(filename string) (*dictionary, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	words, err := parseProfanityWords(file)
+	if err != nil {
+		return nil, err
+	}
+	return newDictionary(words, "file"), nil
+}
+
+// loadLanguageDictionaries reads every <lang>.txt in dir, treating a missing
+// directory as having no per-language lists
+func loadLanguageDictionaries(dir string) (map[string]wordList, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	languages := make(map[string]wordList, len(paths))
+	for _, path := range paths {
+		dict, err := loadDictionaryFile(path)
+		if err != nil {
+			return nil, err
+		}
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".txt"))
+		languages[lang] = dict.words
+	}
+	return languages, nil
+}
+
+// loadAllowlistFile reads the allowlist, treating a missing file as empty
+func loadAllowlistFile(filename string) (wordList, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseProfanityWords(file)
+}
+
+// computeDictionaryVersion derives a short stable identifier from the words
+// in a dictionary, so the same list always yields the same version no matter
+// where it was loaded from or in which order the lines appeared. Without an
+// allowlist or language lists the version depends on the main words alone.
+func computeDictionaryVersion(d *dictionary) string {
+	hash := sha256.New()
+	writeSortedWords(hash, d.words)
+	if len(d.allowed) > 0 {
+		hash.Write([]byte{0})
+		writeSortedWords(hash, d.allowed)
+	}
+	languages := make([]string, 0, len(d.languages))
+	for lang := range d.languages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	for _, lang := range languages {
+		io.WriteString(hash, "\x00"+lang+"\x00")
+		writeSortedWords(hash, d.languages[lang])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// writeSortedWords writes one line per word. Classifications are only
+// included when they differ from the defaults, so plain word lists keep the
+// versions they had before categories existed.
+func writeSortedWords(w io.Writer, words wordList) {
+	sorted := make([]string, 0, len(words))
+	for word := range words {
+		sorted = append(sorted, word)
+	}
+	sort.Strings(sorted)
+	for _, word := range sorted {
+		io.WriteString(w, word)
+		if info := words[word]; info != (wordInfo{Category: defaultWordCategory, Severity: defaultWordSeverity}) {
+			fmt.Fprintf(w, "\t%s\t%d", info.Category, info.Severity)
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// parseProfanityWords reads one entry per line. A line is either just the
+// word, or word<TAB>category<TAB>severity ("shit\tvulgar\t2"); missing
+// fields take the defaults. Duplicates are resolved by duplicateWords.
+func parseProfanityWords(r io.Reader) (wordList, error) {
+	words := make(wordList)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		// Phrases are matched with single spaces between their words
+		word := strings.ToLower(strings.Join(strings.Fields(fields[0]), " "))
+		if word == "" {
+			continue
+		}
+		info := wordInfo{Category: defaultWordCategory, Severity: defaultWordSeverity}
+		if len(fields) > 1 {
+			if category := strings.ToLower(strings.TrimSpace(fields[1])); category != "" {
+				info.Category = category
+			}
+		}
+		if len(fields) > 2 {
+			if raw := strings.TrimSpace(fields[2]); raw != "" {
+				severity, err := strconv.Atoi(raw)
+				if err != nil || severity < 0 {
+					return nil, fmt.Errorf("line %d: invalid severity %q", line, raw)
+				}
+				info.Severity = severity
+			}
+		}
+		if existing, ok := words[word]; ok && duplicateWords == duplicateHighest {
+			info = strongerWord(existing, info)
+		}
+		words[word] = info
+	}
+	return words, scanner.Err()
+}
+
+// strongerWord picks the classification with the higher severity. Equal
+// severities keep the category that sorts first, so the result never
+// depends on line order.
+func strongerWord(a, b wordInfo) wordInfo {
+	if a.Severity != b.Severity {
+		if a.Severity > b.Severity {
+			return a
+		}
+		return b
+	}
+	if a.Category <= b.Category {
+		return a
+	}
+	return b
+}
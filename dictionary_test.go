@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseProfanityWords(t *testing.T) {
+	input := strings.Join([]string{
+		"Shit",
+		"damn\tmild\t1",
+		"fuck\tvulgar\t3",
+		"bastard\tinsult",      // Severity left at the default
+		"crap\t\t2",            // Category left at the default
+		"  son   of a  bitch ", // Phrases are normalized to single spaces
+		"",
+		"   ",
+	}, "\n")
+	words, err := parseProfanityWords(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := wordList{
+		"shit":           {Category: defaultWordCategory, Severity: defaultWordSeverity},
+		"damn":           {Category: "mild", Severity: 1},
+		"fuck":           {Category: "vulgar", Severity: 3},
+		"bastard":        {Category: "insult", Severity: defaultWordSeverity},
+		"crap":           {Category: defaultWordCategory, Severity: 2},
+		"son of a bitch": {Category: defaultWordCategory, Severity: defaultWordSeverity},
+	}
+	if len(words) != len(want) {
+		t.Errorf("got %d words, want %d: %v", len(words), len(want), words)
+	}
+	for word, info := range want {
+		if got, ok := words[word]; !ok || got != info {
+			t.Errorf("%q = %+v (found %v), want %+v", word, got, ok, info)
+		}
+	}
+}
+
+func TestParseProfanityWordsInvalidSeverity(t *testing.T) {
+	for _, line := range []string{"shit\tvulgar\thigh", "shit\tvulgar\t-1", "shit\tvulgar\t1.5"} {
+		_, err := parseProfanityWords(strings.NewReader("damn\n" + line))
+		if err == nil {
+			t.Errorf("%q: expected an error", line)
+		} else if !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: error %q doesn't name the line", line, err)
+		}
+	}
+}
+
+func TestParseProfanityWordsDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		lines  []string
+		want   wordInfo
+	}{
+		{"highest wins when listed later", duplicateHighest, []string{"bitch\tinsult\t2", "bitch\tslur\t4"}, wordInfo{"slur", 4}},
+		{"highest wins when listed first", duplicateHighest, []string{"bitch\tslur\t4", "bitch\tinsult\t2"}, wordInfo{"slur", 4}},
+		{"highest tie keeps the first category by name", duplicateHighest, []string{"bitch\tvulgar\t2", "bitch\tinsult\t2"}, wordInfo{"insult", 2}},
+		{"highest beats a defaulted line", duplicateHighest, []string{"bitch\tinsult\t3", "bitch"}, wordInfo{"insult", 3}},
+		{"last wins", duplicateLast, []string{"bitch\tslur\t4", "bitch\tinsult\t2"}, wordInfo{"insult", 2}},
+		{"last wins when it is lower", duplicateLast, []string{"bitch\tinsult\t3", "bitch"}, wordInfo{defaultWordCategory, defaultWordSeverity}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := duplicateWords
+			duplicateWords = tt.policy
+			t.Cleanup(func() { duplicateWords = previous })
+
+			words, err := parseProfanityWords(strings.NewReader(strings.Join(tt.lines, "\n")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := words["bitch"]; got != tt.want || len(words) != 1 {
+				t.Errorf("words = %+v, want bitch = %+v", words, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowlistWinsOverDictionary(t *testing.T) {
+	dict := testDictionary(wordList{
+		"hell": {Category: "mild", Severity: 1},
+		"shit": {Category: "vulgar", Severity: 5},
+	}).withAllowlist(wordList{"shit": {}})
+
+	matches := findProfanity(dict, "oh shit, what the hell", MatchOptions{Mode: MatchWord})
+	if len(matches.entries) != 1 || matches.entries[0] != "hell" {
+		t.Errorf("matched %v, want only hell", matches.entries)
+	}
+	matches = findProfanity(dict, "oh shit, what the hell", MatchOptions{Mode: MatchWord, Allow: []string{"hell"}})
+	if matches.hits != 0 {
+		t.Errorf("matched %v with hell allowed per request", matches.entries)
+	}
+}
+
+func TestLanguageListReplacesMainList(t *testing.T) {
+	dict := testDictionary(wordList{"shit": {Category: "vulgar", Severity: 2}}).
+		withLanguages(map[string]wordList{"es": {"mierda": {Category: "vulgar", Severity: 3}}})
+
+	if matches := findProfanity(dict.forLanguage("es-MX"), "mierda shit", MatchOptions{Mode: MatchWord}); len(matches.entries) != 1 || matches.entries[0] != "mierda" {
+		t.Errorf("es matched %v, want only mierda", matches.entries)
+	}
+	if matches := findProfanity(dict.forLanguage("en"), "mierda shit", MatchOptions{Mode: MatchWord}); len(matches.entries) != 1 || matches.entries[0] != "shit" {
+		t.Errorf("en matched %v, want only shit", matches.entries)
+	}
+}
+
+func TestLoadAllowlistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	if err := os.WriteFile(path, []byte("Scunthorpe\n\ncocktail\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := loadAllowlistFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := allowed["scunthorpe"]; !ok || len(allowed) != 2 {
+		t.Errorf("allowed = %v", allowed)
+	}
+
+	allowed, err = loadAllowlistFile(filepath.Join(t.TempDir(), "missing.txt"))
+	if err != nil || allowed != nil {
+		t.Errorf("missing file = %v, %v, want an empty allowlist", allowed, err)
+	}
+}
+
+func TestLoadDictionaryFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.txt")
+	extended := filepath.Join(dir, "extended.txt")
+	if err := os.WriteFile(plain, []byte("shit\ndamn\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(extended, []byte("shit\tvulgar\t2\ndamn\tmild\t1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := loadDictionaryFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"shit", "damn"} {
+		if info := dict.words[word]; info != (wordInfo{defaultWordCategory, defaultWordSeverity}) {
+			t.Errorf("plain %s = %+v, want the defaults", word, info)
+		}
+	}
+
+	dict, err = loadDictionaryFile(extended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := dict.words["shit"]; info != (wordInfo{"vulgar", 2}) {
+		t.Errorf("extended shit = %+v", info)
+	}
+	if dict.source != "file" {
+		t.Errorf("source = %q, want file", dict.source)
+	}
+}
+
+func TestFindProfanityReportsSeverityAndCategories(t *testing.T) {
+	dict := testDictionary(wordList{
+		"damn":  {Category: "mild", Severity: 1},
+		"shit":  {Category: "vulgar", Severity: 2},
+		"crap":  {Category: "vulgar", Severity: 1},
+		"bitch": {Category: "insult", Severity: 3},
+	})
+	matches := findProfanity(dict, "damn this crap, shit, you bitch", MatchOptions{Mode: MatchWord})
+	if matches.severity != 3 {
+		t.Errorf("severity = %d, want 3", matches.severity)
+	}
+	if want := []string{"mild", "vulgar", "insult"}; !slices.Equal(matches.categories, want) {
+		t.Errorf("categories = %q, want %q", matches.categories, want)
+	}
+
+	clean := findProfanity(dict, "what a lovely day", MatchOptions{Mode: MatchWord})
+	if clean.severity != 0 || len(clean.categories) != 0 {
+		t.Errorf("clean text: severity = %d, categories = %q", clean.severity, clean.categories)
+	}
+}
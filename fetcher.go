@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript"
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+	"golang.org/x/sync/semaphore"
+)
+
+// TranscriptFetcher retrieves the transcripts of a video in the given
+// languages. The YouTube client implements it; tests can swap in a fake to
+// exercise the retry and language fallback logic without the network.
+type TranscriptFetcher interface {
+	GetTranscripts(videoID string, langs []string) ([]yt_transcript_models.Transcript, error)
+}
+
+// newTranscriptFetcher creates the fetcher for each worker and for language
+// listings
+var newTranscriptFetcher = func() TranscriptFetcher {
+	return yt_transcript.NewClient(yt_transcript.WithCustomFetcher(htmlFetcher{}))
+}
+
+// outboundRequests caps how many YouTube requests are in flight at once,
+// independently of the worker count, see Config.MaxOutbound
+var outboundRequests = semaphore.NewWeighted(5)
+
+// acquireOutbound waits for a free outbound request slot. The caller must call
+// release once its request has finished, even if it stopped waiting for it.
+func acquireOutbound(ctx context.Context) (release func(), err error) {
+	if err := outboundRequests.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { outboundRequests.Release(1) }, nil
+}
+
+// captionKind selects which caption tracks a scan may use
+type captionKind string
+
+const (
+	captionsAny    captionKind = ""
+	captionsManual captionKind = "manual" // Uploaded by a person
+	captionsAuto   captionKind = "auto"   // YouTube's speech recognition
+)
+
+// parseCaptionKind reads the captions parameter: manual, auto or any
+func parseCaptionKind(raw string) (captionKind, error) {
+	switch kind := captionKind(raw); kind {
+	case captionsManual, captionsAuto:
+		return kind, nil
+	case "any":
+		return captionsAny, nil
+	default:
+		return captionsAny, fmt.Errorf("captions must be manual, auto or any")
+	}
+}
+
+// transcriptKind tells manual from auto-generated transcripts. The library
+// reports IsGenerated=false for speech recognition ("asr") tracks, i.e. the
+// flag is inverted.
+func transcriptKind(transcript yt_transcript_models.Transcript) captionKind {
+	if transcript.IsGenerated {
+		return captionsManual
+	}
+	return captionsAuto
+}
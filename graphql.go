@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+// graphqlRequest is the standard GraphQL-over-HTTP request body
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// transcriptField exposes one TranscriptResponse field on the GraphQL type
+func transcriptField(fieldType graphql.Output, get func(TranscriptResponse) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			response, ok := p.Source.(TranscriptResponse)
+			if !ok {
+				return nil, nil
+			}
+			return get(response), nil
+		},
+	}
+}
+
+var profanitySegmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProfanitySegment",
+	Fields: graphql.Fields{
+		"start":    &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"duration": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"word":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"track":    &graphql.Field{Type: graphql.String},
+	},
+})
+
+var wordCountType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "WordCount",
+	Fields: graphql.Fields{
+		"word":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"entry":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"count":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"category": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"severity": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"track":    &graphql.Field{Type: graphql.String},
+	},
+})
+
+// trackResultField resolves a TrackResult field through get
+func trackResultField(fieldType graphql.Output, get func(TrackResult) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			track, ok := p.Source.(TrackResult)
+			if !ok {
+				return nil, nil
+			}
+			return get(track), nil
+		},
+	}
+}
+
+var trackResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TrackResult",
+	Fields: graphql.Fields{
+		"track":          trackResultField(graphql.NewNonNull(graphql.String), func(t TrackResult) interface{} { return t.Track }),
+		"language":       trackResultField(graphql.NewNonNull(graphql.String), func(t TrackResult) interface{} { return t.Language }),
+		"captionType":    trackResultField(graphql.NewNonNull(graphql.String), func(t TrackResult) interface{} { return string(t.CaptionType) }),
+		"profane":        trackResultField(graphql.NewNonNull(graphql.Boolean), func(t TrackResult) interface{} { return t.Profanity }),
+		"words":          trackResultField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(t TrackResult) interface{} { return t.ProfaneWords }),
+		"count":          trackResultField(graphql.NewNonNull(graphql.Int), func(t TrackResult) interface{} { return t.ProfanityCount }),
+		"profanityScore": trackResultField(graphql.NewNonNull(graphql.Int), func(t TrackResult) interface{} { return t.ProfanityScore }),
+	},
+})
+
+var matchContextType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MatchContext",
+	Fields: graphql.Fields{
+		"word":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"before": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"after":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var matchOffsetType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MatchOffset",
+	Fields: graphql.Fields{
+		"word":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"entry": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"start": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"end":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var timeRangeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TimeRange",
+	Fields: graphql.Fields{
+		"start": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"end":   &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+var languageAttemptType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LanguageAttempt",
+	Fields: graphql.Fields{
+		"language": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"found":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"attempts": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"error":    &graphql.Field{Type: graphql.String},
+	},
+})
+
+// deprecatedField marks field as deprecated in favour of another
+func deprecatedField(field *graphql.Field, reason string) *graphql.Field {
+	field.DeprecationReason = reason
+	return field
+}
+
+// scanVerdictField resolves a ScanVerdict field through get
+func scanVerdictField(fieldType graphql.Output, get func(ScanVerdict) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			verdict, ok := p.Source.(ScanVerdict)
+			if !ok {
+				return nil, nil
+			}
+			return get(verdict), nil
+		},
+	}
+}
+
+var scanVerdictType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ScanVerdict",
+	Fields: graphql.Fields{
+		"profane": scanVerdictField(graphql.NewNonNull(graphql.Boolean), func(v ScanVerdict) interface{} { return v.Profanity }),
+		"count":   scanVerdictField(graphql.NewNonNull(graphql.Int), func(v ScanVerdict) interface{} { return v.ProfanityCount }),
+		"words":   scanVerdictField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(v ScanVerdict) interface{} { return v.ProfaneWords }),
+	},
+})
+
+var normalizationComparisonType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "NormalizationComparison",
+	Fields: graphql.Fields{
+		"exact":      &graphql.Field{Type: graphql.NewNonNull(scanVerdictType)},
+		"normalized": &graphql.Field{Type: graphql.NewNonNull(scanVerdictType)},
+		"normalizationOnly": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(matchOffsetType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				comparison, ok := p.Source.(NormalizationComparison)
+				if !ok {
+					return nil, nil
+				}
+				return comparison.NormalizationOnly, nil
+			},
+		},
+	},
+})
+
+var profanityResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProfanityResult",
+	Fields: graphql.Fields{
+		"videoId":             transcriptField(graphql.NewNonNull(graphql.String), func(t TranscriptResponse) interface{} { return t.VideoID }),
+		"language":            transcriptField(graphql.String, func(t TranscriptResponse) interface{} { return nilIfEmpty(t.Language) }),
+		"detectedLanguage":    transcriptField(graphql.String, func(t TranscriptResponse) interface{} { return nilIfEmpty(t.DetectedLanguage) }),
+		"languageConfidence":  transcriptField(graphql.Float, func(t TranscriptResponse) interface{} { return t.LanguageConfidence }),
+		"languageAttempts":    transcriptField(graphql.NewList(graphql.NewNonNull(languageAttemptType)), func(t TranscriptResponse) interface{} { return t.LanguageAttempts }),
+		"captionType":         transcriptField(graphql.String, func(t TranscriptResponse) interface{} { return nilIfEmpty(string(t.CaptionType)) }),
+		"profane":             transcriptField(graphql.NewNonNull(graphql.Boolean), func(t TranscriptResponse) interface{} { return t.Profanity }),
+		"words":               transcriptField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(t TranscriptResponse) interface{} { return t.ProfaneWords }),
+		"count":               transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.ProfanityCount }),
+		"contexts":            transcriptField(graphql.NewList(graphql.NewNonNull(matchContextType)), func(t TranscriptResponse) interface{} { return t.Contexts }),
+		"timestamps":          transcriptField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(profanitySegmentType))), func(t TranscriptResponse) interface{} { return t.ProfanitySegments }),
+		"segments":            deprecatedField(transcriptField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(profanitySegmentType))), func(t TranscriptResponse) interface{} { return t.ProfanitySegments }), "Use timestamps"),
+		"maxSeverity":         transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.MaxSeverity }),
+		"categories":          transcriptField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(t TranscriptResponse) interface{} { return t.Categories }),
+		"wordCounts":          transcriptField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(wordCountType))), func(t TranscriptResponse) interface{} { return t.WordCounts }),
+		"wordsScanned":        transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.WordsScanned }),
+		"density":             transcriptField(graphql.NewNonNull(graphql.Float), func(t TranscriptResponse) interface{} { return t.ProfanityDensity }),
+		"severityScore":       transcriptField(graphql.NewNonNull(graphql.Float), func(t TranscriptResponse) interface{} { return t.SeverityScore }),
+		"profanityScore":      transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.ProfanityScore }),
+		"audienceRating":      transcriptField(graphql.NewNonNull(graphql.String), func(t TranscriptResponse) interface{} { return t.AudienceRating }),
+		"cleanConfidence":     transcriptField(graphql.String, func(t TranscriptResponse) interface{} { return nilIfEmpty(t.CleanConfidence) }),
+		"notes":               transcriptField(graphql.NewList(graphql.NewNonNull(graphql.String)), func(t TranscriptResponse) interface{} { return t.Notes }),
+		"dictVersion":         transcriptField(graphql.NewNonNull(graphql.String), func(t TranscriptResponse) interface{} { return t.DictVersion }),
+		"partial":             transcriptField(graphql.NewNonNull(graphql.Boolean), func(t TranscriptResponse) interface{} { return t.Partial }),
+		"truncated":           transcriptField(graphql.NewNonNull(graphql.Boolean), func(t TranscriptResponse) interface{} { return t.Truncated }),
+		"tracks":              transcriptField(graphql.NewList(graphql.NewNonNull(trackResultType)), func(t TranscriptResponse) interface{} { return t.Tracks }),
+		"scannedRange":        transcriptField(timeRangeType, func(t TranscriptResponse) interface{} { return t.ScannedRange }),
+		"segmentsScanned":     transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.SegmentsScanned }),
+		"segmentsTotal":       transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.SegmentsTotal }),
+		"overlappingSegments": transcriptField(graphql.NewNonNull(graphql.Int), func(t TranscriptResponse) interface{} { return t.OverlappingSegments }),
+		"transcript":          transcriptField(graphql.String, func(t TranscriptResponse) interface{} { return nilIfEmpty(t.Transcript) }),
+		"matchOffsets":        transcriptField(graphql.NewList(graphql.NewNonNull(matchOffsetType)), func(t TranscriptResponse) interface{} { return t.MatchOffsets }),
+		"deduplicated":        transcriptField(graphql.NewNonNull(graphql.Boolean), func(t TranscriptResponse) interface{} { return t.Deduplicated }),
+		"normalizationComparison": transcriptField(normalizationComparisonType, func(t TranscriptResponse) interface{} {
+			if t.NormalizationComparison == nil {
+				return nil
+			}
+			return *t.NormalizationComparison
+		}),
+	},
+})
+
+var profanityOptionsType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProfanityOptions",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"headSeconds":          &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"tailSeconds":          &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"start":                &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"end":                  &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"dedupe":               &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"matchMode":            &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"includeTranscript":    &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"includeOffsets":       &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"minHits":              &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"minDensity":           &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"allow":                &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"captions":             &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"allTracks":            &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"contextWindow":        &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"noCache":              &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"timestamps":           &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"compareNormalization": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+// graphqlQueryParams maps ProfanityOptions fields to the query string
+// parameters parseScanOptions reads. allTracks is handled separately.
+var graphqlQueryParams = map[string]string{
+	"headSeconds":          "head_seconds",
+	"tailSeconds":          "tail_seconds",
+	"start":                "start",
+	"end":                  "end",
+	"dedupe":               "dedupe",
+	"matchMode":            "match_mode",
+	"includeTranscript":    "include_transcript",
+	"includeOffsets":       "include_offsets",
+	"minHits":              "min_hits",
+	"minDensity":           "min_density",
+	"allow":                "allow",
+	"captions":             "captions",
+	"contextWindow":        "context_window",
+	"noCache":              "no_cache",
+	"timestamps":           "timestamps",
+	"compareNormalization": "compare_normalization",
+}
+
+// graphqlScanOptions turns ProfanityOptions into ScanOptions through
+// parseScanOptions, so GraphQL takes and validates exactly what REST does.
+// Error messages name the query string parameters.
+func graphqlScanOptions(raw map[string]interface{}) (ScanOptions, error) {
+	query := url.Values{}
+	for field, value := range raw {
+		if field == "allTracks" {
+			if all, _ := value.(bool); all {
+				query.Set("tracks", "all")
+			}
+			continue
+		}
+		param, ok := graphqlQueryParams[field]
+		if !ok || value == nil {
+			continue
+		}
+		switch value := value.(type) {
+		case []interface{}:
+			words := make([]string, 0, len(value))
+			for _, word := range value {
+				words = append(words, fmt.Sprint(word))
+			}
+			query.Set(param, strings.Join(words, ","))
+		case float64:
+			query.Set(param, strconv.FormatFloat(value, 'g', -1, 64))
+		default:
+			query.Set(param, fmt.Sprint(value))
+		}
+	}
+	return parseScanOptions(query)
+}
+
+// graphqlSchema exposes the profanity check as a read-only query:
+//
+//	profanity(videoId: String!, lang: String, options: ProfanityOptions, dictVersion: String): ProfanityResult
+var graphqlSchema = mustBuildGraphQLSchema()
+
+func mustBuildGraphQLSchema() graphql.Schema {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"profanity": &graphql.Field{
+				Type: profanityResultType,
+				Args: graphql.FieldConfigArgument{
+					"videoId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"lang":    &graphql.ArgumentConfig{Type: graphql.String},
+					"options": &graphql.ArgumentConfig{Type: profanityOptionsType},
+					// Pins the dictionary version like dict_version does
+					"dictVersion": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveProfanity,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		fatal("Failed to build GraphQL schema", "error", err)
+	}
+	return schema
+}
+
+// nilIfEmpty maps an empty string to a GraphQL null
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// resolveProfanity runs the regular worker pipeline for one video
+func resolveProfanity(p graphql.ResolveParams) (interface{}, error) {
+	rawVideoID, _ := p.Args["videoId"].(string)
+	videoID, err := extractVideoID(rawVideoID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid videoId %q: %w", rawVideoID, err)
+	}
+
+	languages := []string{"en"}
+	if lang, _ := p.Args["lang"].(string); lang != "" {
+		languages = []string{lang}
+	}
+
+	raw, _ := p.Args["options"].(map[string]interface{})
+	options, err := graphqlScanOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+	dictVersion, _ := p.Args["dictVersion"].(string)
+	if status, message := dictionaryError(dictVersion); status != 0 {
+		return nil, errors.New(message)
+	}
+
+	response := runJob(Job{Ctx: p.Context, VideoID: videoID, Languages: languages, Options: options})
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+// graphqlHandler serves GraphQL queries over GET (?query=) and POST (JSON body)
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+	} else {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if raw := r.URL.Query().Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	}
+	if req.Query == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing query")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	json.NewEncoder(w).Encode(result)
+}
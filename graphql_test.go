@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// graphqlResult is the GraphQL response envelope
+type graphqlResult struct {
+	Data struct {
+		Profanity map[string]interface{} `json:"profanity"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphqlQuery posts query to the GraphQL endpoint
+func graphqlQuery(t *testing.T, query string) graphqlResult {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query})
+	rec := httptest.NewRecorder()
+	graphqlHandler(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var result graphqlResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// startGraphQLWorkers serves every video with the same short transcript
+func startGraphQLWorkers(t *testing.T) {
+	withoutFallbacks(t)
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript(langs[0], captionsManual, "oh shit", "hello there", "well damn")}, nil
+	}))
+}
+
+func TestGraphQLProfanity(t *testing.T) {
+	startGraphQLWorkers(t)
+	result := graphqlQuery(t, `{ profanity(videoId: "https://youtu.be/graphql0001", lang: "en", options: {noCache: true}) {
+		videoId profane count words dictVersion
+		timestamps { start word }
+		segments { start word }
+	} }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	got := result.Data.Profanity
+	if got["videoId"] != "graphql0001" || got["profane"] != true || got["count"] != float64(2) || got["dictVersion"] != currentDictionary().version {
+		t.Errorf("profanity = %v", got)
+	}
+	timestamps, _ := got["timestamps"].([]interface{})
+	if len(timestamps) != 2 {
+		t.Fatalf("timestamps = %v", got["timestamps"])
+	}
+	if first := timestamps[0].(map[string]interface{}); first["start"] != float64(0) || first["word"] != "shit" {
+		t.Errorf("first timestamp = %v", first)
+	}
+	// segments is the deprecated name for the same list
+	if segments, _ := got["segments"].([]interface{}); len(segments) != len(timestamps) {
+		t.Errorf("segments = %v, timestamps = %v", segments, timestamps)
+	}
+}
+
+func TestGraphQLScanOptions(t *testing.T) {
+	startGraphQLWorkers(t)
+	tests := []struct {
+		name    string
+		options string
+		check   func(t *testing.T, got map[string]interface{})
+	}{
+		{"min_hits above the count", `minHits: 3`, func(t *testing.T, got map[string]interface{}) {
+			if got["profane"] != false || got["count"] != float64(2) {
+				t.Errorf("profane = %v, count = %v", got["profane"], got["count"])
+			}
+		}},
+		{"allow list", `allow: ["shit", "damn"]`, func(t *testing.T, got map[string]interface{}) {
+			if got["profane"] != false {
+				t.Errorf("profane = %v with every word allowed", got["profane"])
+			}
+		}},
+		{"time range", `start: 1.5`, func(t *testing.T, got map[string]interface{}) {
+			if words, _ := got["words"].([]interface{}); len(words) != 1 || words[0] != "damn" {
+				t.Errorf("words = %v, want only damn after 1.5s", got["words"])
+			}
+		}},
+		{"timestamped transcript", `includeTranscript: true, timestamps: true`, func(t *testing.T, got map[string]interface{}) {
+			if transcript, _ := got["transcript"].(string); !strings.Contains(transcript, "1.000000: hello there") {
+				t.Errorf("transcript = %q", got["transcript"])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := graphqlQuery(t, `{ profanity(videoId: "graphql0002", options: {noCache: true, `+tt.options+`}) { profane count words transcript } }`)
+			if len(result.Errors) > 0 {
+				t.Fatal(result.Errors)
+			}
+			tt.check(t, result.Data.Profanity)
+		})
+	}
+}
+
+func TestGraphQLOptionsValidatedLikeREST(t *testing.T) {
+	startGraphQLWorkers(t)
+	tests := []struct {
+		options string
+		query   url.Values // The same options as REST parameters
+	}{
+		{`minHits: 0`, url.Values{"min_hits": {"0"}}},
+		{`minDensity: 2`, url.Values{"min_density": {"2"}}},
+		{`start: 5, end: 2`, url.Values{"start": {"5"}, "end": {"2"}}},
+		{`headSeconds: -1`, url.Values{"head_seconds": {"-1"}}},
+		{`matchMode: "loose"`, url.Values{"match_mode": {"loose"}}},
+		{`timestamps: true, includeOffsets: true`, url.Values{"timestamps": {"true"}, "include_offsets": {"true"}}},
+		{`compareNormalization: true`, url.Values{"compare_normalization": {"true"}}},
+	}
+	for _, tt := range tests {
+		_, restErr := parseScanOptions(tt.query)
+		if restErr == nil {
+			t.Fatalf("%v accepted by REST", tt.query)
+		}
+		result := graphqlQuery(t, `{ profanity(videoId: "graphql0003", options: {`+tt.options+`}) { profane } }`)
+		if len(result.Errors) != 1 || result.Errors[0].Message != restErr.Error() {
+			t.Errorf("%s: errors = %v, want %q", tt.options, result.Errors, restErr)
+		}
+	}
+}
+
+func TestGraphQLCompareNormalization(t *testing.T) {
+	startGraphQLWorkers(t)
+	previous := debugEnabled
+	debugEnabled = true
+	t.Cleanup(func() { debugEnabled = previous })
+
+	result := graphqlQuery(t, `{ profanity(videoId: "graphql0004", options: {noCache: true, compareNormalization: true}) {
+		normalizationComparison { exact { profane count } normalized { count } normalizationOnly { word } }
+	} }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	comparison, _ := result.Data.Profanity["normalizationComparison"].(map[string]interface{})
+	exact, _ := comparison["exact"].(map[string]interface{})
+	if exact["profane"] != true || exact["count"] != float64(2) {
+		t.Errorf("normalizationComparison = %v", result.Data.Profanity["normalizationComparison"])
+	}
+}
+
+func TestGraphQLDictVersion(t *testing.T) {
+	startGraphQLWorkers(t)
+	active := currentDictionary().version
+	result := graphqlQuery(t, `{ profanity(videoId: "graphql0005", dictVersion: "`+active+`", options: {noCache: true}) { dictVersion } }`)
+	if len(result.Errors) > 0 || result.Data.Profanity["dictVersion"] != active {
+		t.Errorf("pinned to the active version: %v, %v", result.Data.Profanity, result.Errors)
+	}
+
+	result = graphqlQuery(t, `{ profanity(videoId: "graphql0005", dictVersion: "not-a-version") { profane } }`)
+	_, want := dictionaryError("not-a-version")
+	if len(result.Errors) != 1 || result.Errors[0].Message != want {
+		t.Errorf("errors = %v, want %q", result.Errors, want)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthResponse structure for the readiness endpoint
+type HealthResponse struct {
+	Status         string   `json:"status"` // "ok", "degraded" or "unavailable"
+	Workers        int      `json:"workers"`
+	ProfanityWords int      `json:"profanity_words"`
+	Dictionary     string   `json:"dictionary"` // Where the loaded word list came from: "embedded", "file", "builtin" or "none"
+	QueueDepth     int      `json:"queue_depth"`
+	QueueCapacity  int      `json:"queue_capacity"` // Depth at which new jobs are turned away, see QUEUE_REJECT_DEPTH
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// healthHandler reports whether the service can take traffic. It answers 503
+// when no dictionary is loaded or the job queue is full, so load balancers
+// stop routing to an instance that can't do useful work. Running on the
+// built-in word list is reported as degraded but still answers 200.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	dict := currentDictionary()
+	response := HealthResponse{
+		Status:         "ok",
+		Workers:        maxWorkers,
+		ProfanityWords: len(dict.words),
+		Dictionary:     dict.source,
+		QueueDepth:     len(jobQueue),
+		QueueCapacity:  min(queueRejectDepth, cap(jobQueue)),
+	}
+
+	if response.ProfanityWords == 0 {
+		response.Problems = append(response.Problems, "profanity dictionary is not loaded")
+	}
+	if response.QueueDepth >= response.QueueCapacity {
+		response.Problems = append(response.Problems, "job queue is full")
+	}
+
+	status := http.StatusOK
+	if len(response.Problems) > 0 {
+		response.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	} else if dict.source == "builtin" {
+		// Serving, but only with the small built-in word list
+		response.Status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// detectLanguageEnabled turns on checking which language a transcript is
+// actually in before picking its word list, see DETECT_LANGUAGE
+var detectLanguageEnabled = true
+
+// minDetectionHits is how many stopwords or letters detection needs before
+// it guesses at all
+const minDetectionHits = 8
+
+// minDetectionConfidence is the share of the evidence the winning language
+// needs before it overrides the language YouTube reported, see
+// LANGUAGE_CONFIDENCE
+var minDetectionConfidence = 0.7
+
+// lowConfidenceLanguage is the word list to scan with when detection isn't
+// confident, such as "en". Empty keeps the caption track's language. Set with
+// LOW_CONFIDENCE_LANGUAGE.
+var lowConfidenceLanguage = ""
+
+// languageStopwords are very common short words that rarely show up in other
+// languages' transcripts. Words common to more than one of the languages
+// (like "a", "de", "en" or "o") are left out since they say nothing, and no
+// word is listed under two languages.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "there", "you", "that", "it", "of", "to", "this", "what", "with", "have", "was", "are", "they", "just", "like", "know", "i'm", "don't"},
+	"es": {"el", "los", "las", "y", "pues", "que", "por", "para", "pero", "muy", "hay", "como", "del", "bueno", "eso", "esto", "yo", "también", "ahora", "qué"},
+	"fr": {"le", "les", "et", "est", "elle", "vous", "nous", "pas", "c'est", "une", "des", "sont", "avec", "mais", "pour", "ça", "oui", "très", "dans", "qui"},
+	"de": {"der", "die", "das", "und", "ist", "ich", "nicht", "sich", "wir", "ein", "eine", "mit", "auf", "sie", "nur", "auch", "aber", "noch", "jetzt", "wie"},
+	"pt": {"ele", "os", "ela", "foi", "é", "não", "um", "uma", "você", "isso", "com", "mas", "muito", "também", "então", "aqui", "eu", "tem", "agora", "ainda"},
+	"it": {"il", "gli", "ancora", "è", "che", "non", "sono", "della", "per", "questa", "questo", "anche", "ma", "molto", "perché", "io", "ci", "hai", "sì", "cosa"},
+	"nl": {"het", "een", "jij", "heel", "ik", "niet", "dat", "naar", "we", "van", "maar", "ook", "zijn", "wat", "nog", "hebben", "er", "wel", "dit", "mijn"},
+}
+
+// stopwordLanguages maps each stopword to the languages listing it
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range languageStopwords {
+		for _, word := range words {
+			index[word] = append(index[word], lang)
+		}
+	}
+	return index
+}()
+
+// scriptLanguages picks a language from the writing system alone for scripts
+// that essentially belong to one language in transcripts
+var scriptLanguages = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"hi", unicode.Devanagari},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+	{"th", unicode.Thai},
+	{"zh", unicode.Han}, // Last, Japanese uses Han too
+}
+
+// detectLanguage guesses the language of a transcript. Text mostly in a
+// non-Latin script is identified by the script; otherwise stopwords are
+// counted per language. It returns the share of the evidence pointing at the
+// best guess, rounded to two decimals, and the guess itself only when that
+// share reaches minDetectionConfidence. Both are empty when there's too
+// little text to tell.
+func detectLanguage(text string) (string, float64) {
+	if lang, confidence := detectScript(text); confidence > 0 {
+		return lang, confidence
+	}
+
+	hits := make(map[string]int)
+	total := 0
+	for _, token := range tokenize(text) {
+		languages := stopwordLanguages[strings.ToLower(trimPunctuation(token))]
+		for _, lang := range languages {
+			hits[lang]++
+		}
+		if len(languages) > 0 {
+			total++
+		}
+	}
+	if total < minDetectionHits {
+		return "", 0
+	}
+	best, bestHits := "", 0
+	for lang, count := range hits {
+		if count > bestHits || (count == bestHits && lang < best) {
+			best, bestHits = lang, count
+		}
+	}
+	return confidentLanguage(best, float64(bestHits)/float64(total))
+}
+
+// confidentLanguage rounds the confidence and drops the language when it
+// falls short of minDetectionConfidence
+func confidentLanguage(lang string, confidence float64) (string, float64) {
+	confidence = math.Round(confidence*100) / 100
+	if confidence < minDetectionConfidence {
+		return "", confidence
+	}
+	return lang, confidence
+}
+
+// detectScript returns the language of the dominant non-Latin script and the
+// share of letters in it, as detectLanguage does. The confidence is 0 when
+// letters are mostly Latin or too few to tell.
+func detectScript(text string) (string, float64) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				counts[script.lang]++
+				break
+			}
+		}
+	}
+	if letters < minDetectionHits {
+		return "", 0
+	}
+	// Kana alongside Han means Japanese, not Chinese
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+	best, bestCount := "", 0
+	for lang, count := range counts {
+		if count > bestCount || (count == bestCount && lang < best) {
+			best, bestCount = lang, count
+		}
+	}
+	if bestCount == 0 || float64(bestCount)/float64(letters) < minDetectionConfidence {
+		return "", 0
+	}
+	return confidentLanguage(best, float64(bestCount)/float64(letters))
+}
+
+// sameLanguage compares language codes ignoring region, so "en-GB" and "en"
+// are the same
+func sameLanguage(a, b string) bool {
+	baseA, _, _ := strings.Cut(strings.ToLower(a), "-")
+	baseB, _, _ := strings.Cut(strings.ToLower(b), "-")
+	return baseA == baseB
+}
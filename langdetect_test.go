@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		lang          string
+		minConfidence float64
+		maxConfidence float64
+	}{
+		{"clearly English", "so what is it that you know about this, I'm telling you they just don't like it and that was the end of the story", "en", 0.9, 1},
+		{"clearly Spanish", "pero yo no sé por qué el perro está en la casa, es que los niños también quieren eso para la fiesta", "es", 0.9, 1},
+		{"Japanese script", "これは日本語のテキストです。とても面白いですね", "ja", 0.9, 1},
+		{"clearly French", "je ne sais pas pourquoi, mais c'est très bien et nous avons des amis avec qui on parle dans le café", "fr", 0.9, 1},
+		{"clearly German", "ich weiß nicht, aber das ist jetzt auch nicht so schlimm und wir haben noch eine Stunde mit der Katze", "de", 0.9, 1},
+		{"clearly Portuguese", "eu não sei, mas isso é muito legal e você também tem uma casa aqui então está tudo bem", "pt", 0.9, 1},
+		{"clearly Italian", "io non lo so, ma questo è molto bello e anche la cosa della pizza per una sera che hai fatto", "it", 0.8, 1},
+		{"clearly Dutch", "ik weet het niet, maar dat is ook wel een mooi huis van mijn vader en we hebben er nog niet", "nl", 0.9, 1},
+		{"Cyrillic script", "Привет, как у тебя дела сегодня вечером", "ru", 0.9, 1},
+		{"Hangul script", "안녕하세요 오늘 날씨가 정말 좋네요 같이 산책할까요", "ko", 0.9, 1},
+		{"Arabic script", "مرحبا كيف حالك اليوم هذا فيديو جميل جدا", "ar", 0.9, 1},
+		{"Han without kana", "今天天气很好我们一起去公园散步吧", "zh", 0.9, 1},
+		{"kana with Han", "今日は天気がいいので公園に行きましょう", "ja", 0.9, 1},
+		{"Latin words in another script", "Привет everyone, как у тебя дела сегодня вечером", "ru", 0.7, 0.9},
+		{"too short to tell", "ok cool", "", 0, 0},
+		{"no stopwords", "pizza tacos burrito sushi ramen pho kebab falafel", "", 0, 0},
+		{"ambiguous mix", "the and is you that it of to el los las y es que por para pero", "", 0.4, 0.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, confidence := detectLanguage(tt.text)
+			if lang != tt.lang {
+				t.Errorf("lang = %q, want %q", lang, tt.lang)
+			}
+			if confidence < tt.minConfidence || confidence > tt.maxConfidence {
+				t.Errorf("confidence = %v, want between %v and %v", confidence, tt.minConfidence, tt.maxConfidence)
+			}
+		})
+	}
+}
+
+func TestDetectLanguageThreshold(t *testing.T) {
+	previous := minDetectionConfidence
+	t.Cleanup(func() { minDetectionConfidence = previous })
+
+	text := "the and is you that it of to el los las y es que por para pero"
+	minDetectionConfidence = 0.4
+	if lang, _ := detectLanguage(text); lang == "" {
+		t.Error("no language with a 0.4 threshold")
+	}
+	minDetectionConfidence = 1
+	if lang, confidence := detectLanguage("so what is it that you know about this, I'm telling you they just don't like it"); lang != "en" || confidence != 1 {
+		t.Errorf("lang = %q, confidence = %v with a threshold of 1", lang, confidence)
+	}
+}
+
+func TestStopwordsNotShared(t *testing.T) {
+	for word, languages := range stopwordLanguages {
+		if len(languages) > 1 {
+			t.Errorf("%q is listed under %v", word, languages)
+		}
+	}
+}
+
+func TestDetectScriptPicksLargestShare(t *testing.T) {
+	previous := minDetectionConfidence
+	t.Cleanup(func() { minDetectionConfidence = previous })
+	minDetectionConfidence = 0.3
+
+	// Both scripts pass the threshold, Cyrillic has the larger share
+	text := "Привет как дела мир αβγδεζηθ"
+	for i := 0; i < 50; i++ {
+		if lang, confidence := detectScript(text); lang != "ru" || confidence != 0.67 {
+			t.Fatalf("detectScript = %q, %v, want ru, 0.67", lang, confidence)
+		}
+	}
+
+	// The largest share still has to reach the threshold
+	minDetectionConfidence = 0.7
+	if lang, confidence := detectScript(text); lang != "" || confidence != 0 {
+		t.Errorf("detectScript = %q, %v below the threshold", lang, confidence)
+	}
+}
+
+func TestLowConfidenceLanguageFallback(t *testing.T) {
+	withoutFallbacks(t)
+	previousDict, previousFallback := currentDictionary(), lowConfidenceLanguage
+	setDictionary(previousDict.withLanguages(map[string]wordList{"es": {"gilipollas": {Category: "vulgar", Severity: 2}}}))
+	t.Cleanup(func() {
+		setDictionary(previousDict)
+		lowConfidenceLanguage = previousFallback
+	})
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		// Far too short for detection to say anything
+		return []yt_transcript_models.Transcript{testTranscript("es", captionsManual, "fuck", "gilipollas")}, nil
+	}))
+
+	for i, tt := range []struct {
+		fallback string
+		want     string
+	}{
+		{"", "gilipollas"}, // Keeps the caption track's language
+		{"en", "fuck"},     // Scans with the main list instead
+	} {
+		lowConfidenceLanguage = tt.fallback
+		response := runJob(Job{VideoID: fmt.Sprintf("langconf%03d", i), Languages: []string{"es"}, Options: defaultScanOptions()})
+		if response.Error != "" {
+			t.Fatal(response.Error)
+		}
+		if len(response.ProfaneWords) != 1 || response.ProfaneWords[0] != tt.want {
+			t.Errorf("fallback %q matched %v, want %s", tt.fallback, response.ProfaneWords, tt.want)
+		}
+		if response.DetectedLanguage != "" || response.LanguageConfidence != 0 {
+			t.Errorf("detected %q at %v from two words", response.DetectedLanguage, response.LanguageConfidence)
+		}
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"en", "en", true},
+		{"en-GB", "en", true},
+		{"pt-BR", "PT-pt", true},
+		{"en", "es", false},
+		{"zh-Hans", "ja", false},
+	} {
+		if got := sameLanguage(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameLanguage(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDetectedLanguagePicksWordList(t *testing.T) {
+	withoutFallbacks(t)
+	previousDict, previousEnabled := currentDictionary(), detectLanguageEnabled
+	setDictionary(previousDict.withLanguages(map[string]wordList{"es": {"gilipollas": {Category: "vulgar", Severity: 2}}}))
+	t.Cleanup(func() {
+		setDictionary(previousDict)
+		detectLanguageEnabled = previousEnabled
+	})
+	// A Spanish video with its captions mislabelled as English
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual,
+			"pero yo no sé por qué el perro está en la casa",
+			"es que los niños también quieren eso para la fiesta, qué gilipollas")}, nil
+	}))
+
+	for i, tt := range []struct {
+		enabled  bool
+		detected string
+		want     []string
+	}{
+		{true, "es", []string{"gilipollas"}},
+		{false, "", []string{}},
+	} {
+		detectLanguageEnabled = tt.enabled
+		response := runJob(Job{VideoID: fmt.Sprintf("langdet%04d", i), Languages: []string{"en"}, Options: defaultScanOptions()})
+		if response.Error != "" {
+			t.Fatal(response.Error)
+		}
+		if response.DetectedLanguage != tt.detected {
+			t.Errorf("detection %v: detected %q, want %q", tt.enabled, response.DetectedLanguage, tt.detected)
+		}
+		if fmt.Sprint(response.ProfaneWords) != fmt.Sprint(tt.want) {
+			t.Errorf("detection %v: matched %v, want %v", tt.enabled, response.ProfaneWords, tt.want)
+		}
+	}
+}
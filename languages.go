@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CaptionLanguage describes one caption track available for a video
+type CaptionLanguage struct {
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	AutoGenerated bool   `json:"auto_generated"`
+}
+
+// ExistsResponse is returned by the exists endpoint
+type ExistsResponse struct {
+	VideoID     string   `json:"video_id"`
+	Exists      bool     `json:"exists"`
+	HasCaptions bool     `json:"has_captions"`
+	Languages   []string `json:"languages"`        // Caption language codes
+	Reason      string   `json:"reason,omitempty"` // Why the video doesn't count as existing, in YouTube's words
+}
+
+// languagesHandler lists the caption tracks a video has, so clients can pick
+// a lang parameter instead of relying on the fallback list
+func languagesHandler(w http.ResponseWriter, r *http.Request) {
+	videoID, err := extractVideoID(mux.Vars(r)["video_id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid video ID: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if err := waitForRateLimit(ctx); err != nil {
+		writeJSONError(w, http.StatusGatewayTimeout, fmt.Sprintf("Timed out listing languages for video %s", videoID))
+		return
+	}
+
+	languages, err := listCaptionLanguages(ctx, videoID)
+	if err != nil {
+		requestLogger(r.Context()).Warn("Failed to list caption languages", "video_id", videoID, "error", err)
+		status, message := languagesError(videoID, err)
+		if status == http.StatusServiceUnavailable {
+			setThrottleRetryAfter(w)
+		}
+		writeJSONError(w, status, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(languages)
+}
+
+// existsHandler checks that a video resolves to something playable and
+// lists its caption languages without downloading or scanning any captions.
+// A missing, private or otherwise unplayable video is a normal answer
+// (exists=false with the reason YouTube gave), only failures to find out are
+// errors.
+func existsHandler(w http.ResponseWriter, r *http.Request) {
+	videoID, err := extractVideoID(mux.Vars(r)["video_id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid video ID: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if err := waitForRateLimit(ctx); err != nil {
+		writeJSONError(w, http.StatusGatewayTimeout, fmt.Sprintf("Timed out checking video %s", videoID))
+		return
+	}
+
+	probe, err := probeVideo(ctx, videoID)
+	if err != nil {
+		requestLogger(r.Context()).Warn("Failed to check video", "video_id", videoID, "error", err)
+		status, message := languagesError(videoID, err)
+		if status == http.StatusServiceUnavailable {
+			setThrottleRetryAfter(w)
+		}
+		writeJSONError(w, status, message)
+		return
+	}
+
+	response := ExistsResponse{VideoID: videoID, Languages: []string{}}
+	if probe.playable() {
+		response.Exists = true
+		for _, track := range probe.tracks {
+			response.HasCaptions = true
+			response.Languages = append(response.Languages, track.Code)
+		}
+	} else {
+		response.Reason = probe.reason
+		if response.Reason == "" {
+			response.Reason = probe.status
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// listCaptionLanguages lists the caption tracks of a playable video from the
+// player response, without downloading them
+func listCaptionLanguages(ctx context.Context, videoID string) ([]CaptionLanguage, error) {
+	probe, err := probeVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if err := probe.err(); err != nil {
+		return nil, err
+	}
+	if len(probe.tracks) == 0 {
+		return nil, errNoCaptions
+	}
+	return probe.tracks, nil
+}
+
+// videoProbe is what YouTube's player API says about a video
+type videoProbe struct {
+	status string // playabilityStatus.status: "OK", "LOGIN_REQUIRED", "ERROR", "UNPLAYABLE"...
+	reason string // Why it isn't playable, in YouTube's words
+	tracks []CaptionLanguage
+}
+
+// playable reports whether the video resolved to something that plays
+func (p videoProbe) playable() bool {
+	return p.status == "OK"
+}
+
+// err describes why a video isn't playable, or is nil when it is
+func (p videoProbe) err() error {
+	switch {
+	case p.playable():
+		return nil
+	case strings.Contains(strings.ToLower(p.reason), "private"):
+		return fmt.Errorf("%w: %s", errPrivateVideo, p.reason)
+	}
+	return fmt.Errorf("%w: %s %s", errVideoUnavailable, p.status, p.reason)
+}
+
+// innertubeAPIKeyPattern finds the player API key on the watch page, as the
+// transcript library does
+var innertubeAPIKeyPattern = regexp.MustCompile(`"INNERTUBE_API_KEY":\s*"([a-zA-Z0-9_-]+)"`)
+
+// probeVideo loads the watch page and the player response, the same two
+// requests the transcript library starts with, but stops before fetching any
+// caption track. The requests can't be cancelled, so they're abandoned when
+// ctx is done.
+func probeVideo(ctx context.Context, videoID string) (videoProbe, error) {
+	type result struct {
+		probe videoProbe
+		err   error
+	}
+	release, err := acquireOutbound(ctx)
+	if err != nil {
+		return videoProbe{}, err
+	}
+	results := make(chan result, 1)
+	go func() {
+		defer release()
+		var fetcher htmlFetcher
+		page, err := fetcher.FetchVideo(videoID)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		var apiKey string
+		if match := innertubeAPIKeyPattern.FindSubmatch(page); match != nil {
+			apiKey = string(match[1])
+		}
+		data, err := fetcher.FetchInnertubeData(videoID, apiKey)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		results <- result{probe: parsePlayerResponse(data)}
+	}()
+
+	select {
+	case res := <-results:
+		return res.probe, res.err
+	case <-ctx.Done():
+		return videoProbe{}, ctx.Err()
+	}
+}
+
+// parsePlayerResponse reads the playability status and caption track list
+// out of a player API response
+func parsePlayerResponse(data map[string]interface{}) videoProbe {
+	var probe videoProbe
+	if status, ok := data["playabilityStatus"].(map[string]interface{}); ok {
+		probe.status, _ = status["status"].(string)
+		probe.reason, _ = status["reason"].(string)
+	}
+	captions, _ := data["captions"].(map[string]interface{})
+	renderer, _ := captions["playerCaptionsTracklistRenderer"].(map[string]interface{})
+	tracks, _ := renderer["captionTracks"].([]interface{})
+	for _, raw := range tracks {
+		track, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		language := CaptionLanguage{}
+		language.Code, _ = track["languageCode"].(string)
+		language.Name = textValue(track["name"])
+		kind, _ := track["kind"].(string)
+		language.AutoGenerated = kind == "asr"
+		if language.Code != "" {
+			probe.tracks = append(probe.tracks, language)
+		}
+	}
+	return probe
+}
+
+// textValue reads a player API text object, which is either {simpleText} or
+// {runs: [{text}]}
+func textValue(raw interface{}) string {
+	value, _ := raw.(map[string]interface{})
+	if text, ok := value["simpleText"].(string); ok {
+		return text
+	}
+	runs, _ := value["runs"].([]interface{})
+	var text strings.Builder
+	for _, run := range runs {
+		if run, ok := run.(map[string]interface{}); ok {
+			part, _ := run["text"].(string)
+			text.WriteString(part)
+		}
+	}
+	return text.String()
+}
+
+// languagesError maps a listing failure to a status code and message
+func languagesError(videoID string, err error) (int, string) {
+	switch err = classifyFetchError(err); {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout, fmt.Sprintf("Timed out listing languages for video %s", videoID)
+	case errors.Is(err, errYouTubeThrottled):
+		return http.StatusServiceUnavailable, fetchErrorMessage(videoID, captionsAny, err)
+	case errors.Is(err, errPrivateVideo):
+		return http.StatusForbidden, fmt.Sprintf("Video %s is private and transcripts cannot be accessed.", videoID)
+	case errors.Is(err, errVideoUnavailable):
+		return http.StatusForbidden, fmt.Sprintf("Video %s is unavailable or has been removed.", videoID)
+	case errors.Is(err, errNoCaptions):
+		return http.StatusNotFound, fmt.Sprintf("No captions/transcripts are available for video %s.", videoID)
+	}
+	return http.StatusInternalServerError, fmt.Sprintf("Failed to list languages for video %s", videoID)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// playerResponse decodes a player API response the way FetchInnertubeData does
+func playerResponse(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePlayerResponsePlayable(t *testing.T) {
+	probe := parsePlayerResponse(playerResponse(t, `{
+		"playabilityStatus": {"status": "OK"},
+		"captions": {"playerCaptionsTracklistRenderer": {"captionTracks": [
+			{"baseUrl": "https://example.com/en", "languageCode": "en", "name": {"simpleText": "English"}},
+			{"baseUrl": "https://example.com/asr", "languageCode": "en", "kind": "asr", "name": {"runs": [{"text": "English "}, {"text": "(auto-generated)"}]}}
+		]}}
+	}`))
+	if !probe.playable() || probe.err() != nil {
+		t.Fatalf("probe = %+v, want playable", probe)
+	}
+	want := []CaptionLanguage{
+		{Code: "en", Name: "English"},
+		{Code: "en", Name: "English (auto-generated)", AutoGenerated: true},
+	}
+	if len(probe.tracks) != len(want) {
+		t.Fatalf("tracks = %+v, want %+v", probe.tracks, want)
+	}
+	for i := range want {
+		if probe.tracks[i] != want[i] {
+			t.Errorf("track %d = %+v, want %+v", i, probe.tracks[i], want[i])
+		}
+	}
+}
+
+func TestParsePlayerResponseNoCaptions(t *testing.T) {
+	probe := parsePlayerResponse(playerResponse(t, `{"playabilityStatus": {"status": "OK"}}`))
+	if !probe.playable() || len(probe.tracks) != 0 {
+		t.Errorf("probe = %+v, want playable without tracks", probe)
+	}
+}
+
+func TestParsePlayerResponseUnknownVideo(t *testing.T) {
+	// Unknown and removed IDs have no captions section either, which the
+	// transcript library reports the same way as a video without captions
+	probe := parsePlayerResponse(playerResponse(t, `{
+		"playabilityStatus": {"status": "ERROR", "reason": "This video is unavailable"}
+	}`))
+	if probe.playable() {
+		t.Fatal("unknown video reported as playable")
+	}
+	if err := probe.err(); !errors.Is(err, errVideoUnavailable) {
+		t.Errorf("err = %v, want errVideoUnavailable", err)
+	}
+}
+
+func TestParsePlayerResponsePrivateVideo(t *testing.T) {
+	probe := parsePlayerResponse(playerResponse(t, `{
+		"playabilityStatus": {"status": "LOGIN_REQUIRED", "reason": "This video is private"}
+	}`))
+	if probe.playable() {
+		t.Fatal("private video reported as playable")
+	}
+	if err := probe.err(); !errors.Is(err, errPrivateVideo) {
+		t.Errorf("err = %v, want errPrivateVideo", err)
+	}
+}
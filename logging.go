@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging installs the default structured logger. LOG_LEVEL picks the
+// minimum level (debug, info, warn or error) and LOG_FORMAT the output: JSON
+// for log aggregators by default, or "text" for reading locally.
+func setupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envString("LOG_LEVEL", "info"))); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid LOG_LEVEL: %v\n", err)
+		os.Exit(1)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := envString("LOG_FORMAT", "json"); format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid LOG_FORMAT %q, expected \"json\" or \"text\"\n", format)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -1,300 +1,1484 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript"
 	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_formatters"
 	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 // Response structure for the API
 type TranscriptResponse struct {
-	VideoID   string `json:"video_id"`
-	Profanity bool   `json:"profanity"`
-	Error     string `json:"-"` // Omit from JSON responses
+	VideoID             string          `json:"video_id"`
+	Tag                 string          `json:"tag,omitempty"`                 // Client-supplied correlation tag, echoed back untouched
+	DictVersion         string          `json:"dict_version"`                  // Version of the dictionary the verdict was computed with
+	Language            string          `json:"language,omitempty"`            // Language of the transcript that was scanned
+	DetectedLanguage    string          `json:"detected_language,omitempty"`   // Language detected from the text, picks the word list when set
+	LanguageConfidence  float64         `json:"language_confidence,omitempty"` // Share of the text backing the best language guess, 0 to 1
+	LanguageAttempts    []AttemptResult `json:"language_attempts,omitempty"`   // What happened to each language tried, in order
+	CaptionType         captionKind     `json:"caption_type,omitempty"`        // manual or auto
+	Profanity           bool            `json:"profanity"`                     // Whether the hits meet the min_hits and min_density thresholds
+	ProfaneWords        []string        `json:"profane_words"`                 // Distinct words that triggered the flag, as they appeared in the transcript
+	ProfanityCount      int             `json:"profanity_count"`               // Total profane occurrences, repeats included
+	WordCounts          []WordCount     `json:"word_counts"`                   // Per-word breakdown of the matches
+	ProfanitySegments   []Segment       `json:"profanity_segments"`            // When each hit occurs, from the timed transcript lines
+	Contexts            []MatchContext  `json:"contexts,omitempty"`            // Each hit with the words around it, see context_window
+	MatchOffsets        []MatchOffset   `json:"match_offsets,omitempty"`       // Where each hit is in transcript, only with include_offsets=true
+	MaxSeverity         int             `json:"max_severity"`                  // Highest dictionary severity among the matches, 0 when clean
+	Categories          []string        `json:"categories"`                    // Dictionary categories of the matches
+	ProfanityDensity    float64         `json:"profanity_density"`             // Profane occurrences divided by words scanned
+	WordsScanned        int             `json:"words_scanned"`                 // Number of words the density is relative to
+	SeverityScore       float64         `json:"severity_score"`                // Repetition-weighted severity, see repetitionScore
+	AudienceRating      string          `json:"audience_rating"`               // Rating bucket for the severity score, see audienceRatings
+	ProfanityScore      int             `json:"profanity_score"`               // 0 to 100 from count, density and severity, see profanityScore
+	CleanConfidence     string          `json:"clean_confidence,omitempty"`    // How far a clean verdict can be trusted: high, medium or low
+	Notes               []string        `json:"notes,omitempty"`               // Why a clean verdict isn't high confidence
+	Partial             bool            `json:"partial,omitempty"`             // Set when the segment cap cut the scan short
+	Truncated           bool            `json:"truncated,omitempty"`           // Set when the character cap cut the scan short
+	Tracks              []TrackResult   `json:"tracks,omitempty"`              // Each caption track scanned, only with tracks=all
+	ScannedRange        *TimeRange      `json:"scanned_range,omitempty"`       // The start/end window after clamping to the video length
+	SegmentsScanned     int             `json:"segments_scanned,omitempty"`    // Number of transcript segments actually scanned
+	SegmentsTotal       int             `json:"segments_total,omitempty"`      // Number of segments the transcript had
+	OverlappingSegments int             `json:"overlapping_segments"`          // Segments repeating text from the one before
+	Deduplicated        bool            `json:"deduplicated,omitempty"`        // Set when overlapping text was removed before scanning
+	Transcript          string          `json:"transcript,omitempty"`          // The text that was scanned, only with include_transcript=true
+	Metadata            *VideoMetadata  `json:"metadata,omitempty"`            // Only present when requested and the lookup succeeded
+	Error               string          `json:"-"`                             // Omit from JSON responses
+	Err                 error           `json:"-"`                             // What kind of failure Error describes, for errorStatusCode
+	Cached              bool            `json:"-"`                             // Served from the results cache
+	// Verdicts with and without normalization, only with compare_normalization=true
+	NormalizationComparison *NormalizationComparison `json:"normalization_comparison,omitempty"`
 }
 
 // ErrorResponse structure for API errors
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error            string          `json:"error"`
+	LanguageAttempts []AttemptResult `json:"language_attempts,omitempty"`
 }
 
 // Global worker pool to manage concurrent requests
 var (
-	maxWorkers = 5 // Reduced from 10 to be less aggressive
+	maxWorkers = 5 // Reduced from 10 to be less aggressive, see Config
 	jobQueue   = make(chan Job, 100)
 	wg         sync.WaitGroup
-	// Rate limiter: allow one request every 2 seconds
-	rateLimiter = time.NewTicker(2 * time.Second)
+	// New jobs are turned away with a 429 once this many are waiting, since
+	// they couldn't start in reasonable time (QUEUE_REJECT_DEPTH)
+	queueRejectDepth = 50
+	// Guards closing jobQueue on shutdown, see enqueueJob
+	queueMu     sync.RWMutex
+	queueClosed bool
+	// Token bucket shared by all workers: one YouTube request every
+	// RATE_LIMIT_MS on average, with up to RATE_LIMIT_BURST at once. Bursts
+	// let idle workers start in parallel, but sustained throughput is still
+	// 1000/RATE_LIMIT_MS requests per second however many workers there are.
+	rateLimiter *rate.Limiter
+	// Maximum number of transcript segments scanned per video (0 = unlimited)
+	maxSegments      = 0
+	segmentLimitMode = segmentLimitTruncate
+	// Maximum number of transcript characters scanned per video (0 = unlimited)
+	maxTranscriptChars = 1_000_000
+	// Whether overlapping segment text is removed when the request doesn't say
+	dedupeSegmentsDefault = false
+	// How long a single-video request may take before answering 504
+	requestTimeout = 30 * time.Second
 )
 
+// ScanOptions holds per-request settings that shape what part of the
+// transcript is scanned
+type ScanOptions struct {
+	HeadSeconds float64 // Only scan the first N seconds (0 = no limit)
+	TailSeconds float64 // Only scan the last N seconds (0 = no limit)
+	// Only scan between these seconds, see selectTimeRange. HasRange is set
+	// when either was given.
+	RangeStart float64
+	RangeEnd   float64 // 0 = to the end of the video
+	HasRange   bool
+	Dedupe     bool // Drop text repeated across consecutive segments before scanning
+	Match      MatchOptions
+	Transcript bool        // Return the scanned text in the response
+	Timestamps bool        // Prefix each line of the returned text with its start time
+	Offsets    bool        // Return where each hit is in the scanned text, implies Transcript
+	MinHits    int         // Occurrences needed before Profanity is set
+	MinDensity float64     // Profanity density needed before Profanity is set
+	Captions   captionKind // Only scan caption tracks of this kind
+	AllTracks  bool        // Scan every track of the language and report the worst, see mergeTrackScans
+	NoCache    bool        // Neither read nor write the results cache, see skipsCache
+	// Words of context returned around each hit (0 = no contexts)
+	ContextWindow int
+	// Scan again with exact matching only and report the difference, see
+	// compareNormalization. Only with DEBUG=true.
+	CompareNormalization bool
+}
+
+// defaultScanOptions returns the options used when a request doesn't override
+// them
+func defaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Dedupe:        dedupeSegmentsDefault,
+		Match:         MatchOptions{Mode: defaultMatchMode},
+		MinHits:       minHitsDefault,
+		MinDensity:    minDensityDefault,
+		ContextWindow: contextWindowDefault,
+	}
+}
+
 // Job represents a transcript fetch request
 type Job struct {
+	Ctx       context.Context // Cancelled when nobody is waiting for the result any more
 	VideoID   string
 	Languages []string
+	Options   ScanOptions
+	Tag       string // Opaque client tag copied onto the response
+	RequestID string // See requestIDMiddleware, for correlating log lines
 	Response  chan TranscriptResponse
 }
 
-var profanityWords map[string]struct{}
-
 func main() {
+	strict := flag.Bool("strict", false, "fail to start if the profanity dictionary can't be loaded instead of using the built-in fallback list")
+	flag.Parse()
+
+	setupLogging()
+	build := buildVersion()
+	slog.Info("Starting", "commit", build.Commit, "build_time", build.BuildTime, "go_version", build.GoVersion)
+	config := loadConfig()
+	maxWorkers = config.MaxWorkers
+	rateLimiter = rate.NewLimiter(rate.Every(config.RateLimit), config.RateBurst)
+	outboundRequests = semaphore.NewWeighted(int64(config.MaxOutbound))
+	if raw := envString("YT_PROXY_URL", ""); raw != "" {
+		proxies, err := parseProxyURLs(raw)
+		if err != nil {
+			fatal("Invalid YT_PROXY_URL", "error", err)
+		}
+		youtubeProxies = newProxyPool(proxies)
+		for _, proxyURL := range proxies {
+			slog.Info("Routing YouTube requests through proxy", "proxy", proxyURL.Redacted())
+		}
+	}
+
 	// Load profanity words
-	log.Println("Loading profanity words...")
-	err := loadProfanityWords("eng.txt")
+	dictionaryPath = envString("PROFANITY_FILE", dictionaryPath)
+	if dictionaryPath != "" {
+		slog.Info("Loading profanity words", "path", dictionaryPath)
+	} else {
+		slog.Info("Loading embedded profanity words, set PROFANITY_FILE to use another list")
+	}
+	duplicateWords = envString("DUPLICATE_WORDS", duplicateWords)
+	if duplicateWords != duplicateHighest && duplicateWords != duplicateLast {
+		fatal(fmt.Sprintf("Invalid DUPLICATE_WORDS, expected %q or %q", duplicateHighest, duplicateLast), "value", duplicateWords)
+	}
+	dict, err := loadMainDictionary()
+	if err != nil {
+		if *strict {
+			fatal("Failed to load profanity words", "error", err)
+		}
+		switch fallback := envString("DICTIONARY_FALLBACK", "builtin"); fallback {
+		case "builtin":
+			slog.Warn("Failed to load profanity words, falling back to the built-in minimal list. Detection will be degraded, run with --strict to fail instead.",
+				"error", err)
+			words, err := parseProfanityWords(strings.NewReader(fallbackProfanityWords))
+			if err != nil {
+				fatal("Failed to load built-in profanity words", "error", err)
+			}
+			dict = newDictionary(words, "builtin")
+		case "none":
+			slog.Error("Failed to load profanity words, detection is unavailable until the dictionary is reloaded",
+				"error", err)
+			dict = newDictionary(wordList{}, "none")
+		default:
+			fatal("Invalid DICTIONARY_FALLBACK, expected \"builtin\" or \"none\"", "value", fallback)
+		}
+	}
+	languages, err := loadLanguageDictionaries(languageDictionaryDir)
+	if err != nil {
+		fatal("Failed to load language dictionaries", "error", err)
+	}
+	allowed, err := loadAllowlistFile(allowlistPath)
 	if err != nil {
-		log.Fatalf("Failed to load profanity words: %v", err)
+		fatal("Failed to load allowlist", "error", err)
+	}
+	dict = dict.withLanguages(languages).withAllowlist(allowed)
+	setDictionary(dict)
+	slog.Info("Loaded profanity words", "words", len(dict.words), "languages", len(dict.languages),
+		"allowlisted", len(dict.allowed), "dict_version", dict.version)
+
+	maxSegments = envInt("MAX_SEGMENTS", maxSegments)
+	segmentLimitMode = envString("SEGMENT_LIMIT_MODE", segmentLimitMode)
+	maxTranscriptChars = envInt("MAX_TRANSCRIPT_CHARS", maxTranscriptChars)
+	repetitionExponent = envFloat("REPETITION_EXPONENT", repetitionExponent)
+	if repetitionExponent < 0 || repetitionExponent > 1 {
+		fatal("Invalid REPETITION_EXPONENT, expected a value between 0 and 1", "value", repetitionExponent)
+	}
+	if segmentLimitMode != segmentLimitTruncate && segmentLimitMode != segmentLimitSample {
+		fatal(fmt.Sprintf("Invalid SEGMENT_LIMIT_MODE, expected %q or %q", segmentLimitTruncate, segmentLimitSample), "value", segmentLimitMode)
+	}
+	metadataTimeout = time.Duration(envInt("METADATA_TIMEOUT_MS", int(metadataTimeout/time.Millisecond))) * time.Millisecond
+	metadataRetries = envInt("METADATA_RETRIES", metadataRetries)
+	if raw := envString("FALLBACK_LANGUAGES", ""); raw != "" {
+		fallbackLanguages = parseFallbackLanguages(raw)
+	}
+	queueRejectDepth = envPositiveInt("QUEUE_REJECT_DEPTH", queueRejectDepth)
+	enqueueTimeout = time.Duration(envPositiveInt("ENQUEUE_TIMEOUT_MS", int(enqueueTimeout/time.Millisecond))) * time.Millisecond
+	maxRetryDuration = time.Duration(envInt("MAX_RETRY_DURATION_MS", int(maxRetryDuration/time.Millisecond))) * time.Millisecond
+	batchJobTTL = time.Duration(envPositiveInt("BATCH_JOB_TTL_SECONDS", int(batchJobTTL/time.Second))) * time.Second
+	throttleRetryAfter = time.Duration(envPositiveInt("THROTTLE_RETRY_AFTER_SECONDS", int(throttleRetryAfter/time.Second))) * time.Second
+	requestTimeout = time.Duration(envPositiveInt("REQUEST_TIMEOUT_SECONDS", int(requestTimeout/time.Second))) * time.Second
+	debugEnabled = envString("DEBUG", "false") == "true"
+	dedupeSegmentsDefault = envString("DEDUPE_SEGMENTS", "false") == "true"
+	stripInnerPunctuation = envString("STRIP_INNER_PUNCTUATION", "false") == "true"
+	normalizeLeetspeak = envString("NORMALIZE_LEETSPEAK", "false") == "true"
+	collapseElongation = envString("COLLAPSE_ELONGATION", "false") == "true"
+	matchInflections = envString("MATCH_INFLECTIONS", "false") == "true"
+	splitJoinedWords = envString("SPLIT_JOINED_WORDS", "false") == "true"
+	detectLanguageEnabled = envString("DETECT_LANGUAGE", "true") != "false"
+	minDetectionConfidence = envFloat("LANGUAGE_CONFIDENCE", minDetectionConfidence)
+	if minDetectionConfidence < 0 || minDetectionConfidence > 1 {
+		fatal("Invalid LANGUAGE_CONFIDENCE, expected a fraction between 0 and 1", "value", minDetectionConfidence)
+	}
+	lowConfidenceLanguage = envString("LOW_CONFIDENCE_LANGUAGE", lowConfidenceLanguage)
+	contextWindowDefault = envInt("CONTEXT_WINDOW", contextWindowDefault)
+	if contextWindowDefault < 0 || contextWindowDefault > maxContextWindow {
+		fatal(fmt.Sprintf("Invalid CONTEXT_WINDOW, expected a value between 0 and %d", maxContextWindow), "value", contextWindowDefault)
+	}
+	minHitsDefault = envPositiveInt("MIN_HITS", minHitsDefault)
+	cleanMinWords = envInt("CLEAN_MIN_WORDS", cleanMinWords)
+	minDensityDefault = envFloat("MIN_DENSITY", minDensityDefault)
+	if minDensityDefault < 0 || minDensityDefault > 1 {
+		fatal("Invalid MIN_DENSITY, expected a fraction between 0 and 1", "value", minDensityDefault)
+	}
+	if defaultMatchMode, err = parseMatchMode(envString("MATCH_MODE", string(defaultMatchMode))); err != nil {
+		fatal("Invalid MATCH_MODE", "error", err)
+	}
+	audienceRatings = mustParseAudienceRatings(envString("AUDIENCE_RATINGS", defaultAudienceRatings))
+	profanityScoreWeights = mustParseScoreWeights(envString("PROFANITY_SCORE_WEIGHTS", defaultScoreWeights))
+
+	// Results cache
+	if neverCachePatterns, err = parseNeverCachePatterns(envString("NO_CACHE_VIDEOS", "")); err != nil {
+		fatal("Invalid NO_CACHE_VIDEOS", "error", err)
+	}
+	if cacheTTL := time.Duration(envInt("CACHE_TTL_SECONDS", 3600)) * time.Second; cacheTTL > 0 {
+		// Videos without a transcript are checked again sooner in case
+		// captions were added, 0 stops caching them. Never longer than
+		// successful results.
+		negativeTTL := min(time.Duration(envInt("NEGATIVE_CACHE_TTL_SECONDS", 900))*time.Second, cacheTTL)
+		if path := envString("CACHE_DB", ""); path != "" {
+			db, err := openSQLiteCache(path, cacheTTL, negativeTTL)
+			if err != nil {
+				fatal("Failed to open cache database", "path", path, "error", err)
+			}
+			db.startSweeper(time.Minute)
+			cache = db
+			slog.Info("Caching results in SQLite", "path", path, "ttl", cacheTTL, "negative_ttl", negativeTTL)
+		} else {
+			memory := newResultCache(cacheTTL, negativeTTL)
+			memory.startSweeper(time.Minute)
+			cache = memory
+			slog.Info("Caching results", "ttl", cacheTTL, "negative_ttl", negativeTTL)
+		}
 	}
-	log.Printf("Loaded profanity words successfully")
 
 	// Initialize worker pool
-	log.Println("Starting worker pool...")
+	slog.Info("Starting worker pool", "workers", maxWorkers, "rate_limit", config.RateLimit, "rate_burst", config.RateBurst,
+		"max_outbound", config.MaxOutbound)
 	startWorkerPool()
+	asyncBatches.startSweeper(time.Minute)
+
+	if openapiDocument, err = buildOpenAPIDocument(); err != nil {
+		fatal("Failed to build OpenAPI document", "error", err)
+	}
 
 	// Set up router
 	r := mux.NewRouter()
+	r.HandleFunc("/healthz", healthHandler).Methods("GET")
+	r.HandleFunc("/version", versionHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/transcript", getTranscriptHandler).Methods("GET")
 	r.HandleFunc("/transcript/{video_id}", getTranscriptHandler).Methods("GET")
+	r.HandleFunc("/transcript/{video_id}/languages", languagesHandler).Methods("GET")
+	r.HandleFunc("/transcript/{video_id}/exists", existsHandler).Methods("GET")
+	r.HandleFunc("/transcript/{video_id}/analyze", analyzeHandler).Methods("GET")
+	r.HandleFunc("/transcript/batch", batchHandler).Methods("POST")
+	r.HandleFunc("/transcript/batch/stream", batchEventsHandler).Methods("GET")
+	r.HandleFunc("/transcript/batch/{job_id}", batchJobHandler).Methods("GET")
+	r.HandleFunc("/transcript/batch/{job_id}", cancelBatchJobHandler).Methods("DELETE")
+	r.HandleFunc("/compare", compareHandler).Methods("GET")
+	r.HandleFunc("/graphql", graphqlHandler).Methods("GET", "POST")
+	r.HandleFunc("/openapi.json", openapiHandler).Methods("GET")
+	r.HandleFunc("/docs", docsHandler).Methods("GET")
+	if debugEnabled {
+		slog.Info("Debug endpoints enabled")
+		r.HandleFunc("/explain", explainHandler).Methods("GET")
+		r.HandleFunc("/debug/tokens", tokensHandler).Methods("GET", "POST")
+	}
+
+	// Optional HTTP Basic auth, off unless credentials are configured
+	basicAuthUsers := parseBasicAuthUsers(envString("BASIC_AUTH_USERS", ""))
+	if len(basicAuthUsers) > 0 {
+		slog.Info("Basic auth enabled", "credentials", len(basicAuthUsers))
+	}
+	if adminToken := envString("ADMIN_TOKEN", ""); adminToken != "" {
+		admin := r.PathPrefix("/admin").Subrouter()
+		admin.Use(adminAuthMiddleware(adminToken))
+		admin.HandleFunc("/reload-dictionary", reloadDictionaryHandler).Methods("POST")
+		admin.HandleFunc("/stats", statsHandler).Methods("GET")
+	}
+
+	// Optional per-client rate limit, off unless CLIENT_RATE_LIMIT is set
+	var clients *clientLimiter
+	if perMinute := envInt("CLIENT_RATE_LIMIT", 0); perMinute > 0 {
+		trustedProxyHops = envInt("TRUSTED_PROXY_HOPS", trustedProxyHops)
+		if trustedProxyHops < 0 {
+			fatal("Invalid TRUSTED_PROXY_HOPS, expected a non-negative number", "value", trustedProxyHops)
+		}
+		burst := envPositiveInt("CLIENT_RATE_BURST", max(perMinute/6, 1))
+		clients = newClientLimiter(perMinute, burst)
+		clients.startSweeper(time.Minute)
+		slog.Info("Client rate limit enabled", "per_minute", perMinute, "burst", burst, "trusted_proxy_hops", trustedProxyHops)
+	}
+
+	r.Use(requestIDMiddleware)
+	r.Use(metricsMiddleware)
+	r.Use(clientLimitMiddleware(clients))
+	r.Use(basicAuthMiddleware(basicAuthUsers))
+	if envString("COMPRESS_RESPONSES", "true") != "false" {
+		r.Use(compressMiddleware)
+	}
 
 	// Add CORS middleware
-	corsHandler := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "HEAD", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "X-Requested-With"}),
-	)(r)
+	allowedOrigins := parseAllowedOrigins(envString("ALLOWED_ORIGINS", "*"))
+	handler := corsHandler(r, allowedOrigins)
+
+	server := &http.Server{
+		Addr:    ":" + config.Port,
+		Handler: handler,
+	}
+
+	// Shut down cleanly on Ctrl-C or when the container is stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("Server is running", "port", config.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", "error", err)
+		}
+	}()
 
-	fmt.Println("Server is running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", corsHandler))
+	<-ctx.Done()
+	stop()
+	shutdown(server, time.Duration(envInt("SHUTDOWN_TIMEOUT_SECONDS", 30))*time.Second)
+}
+
+// shutdown stops accepting requests, lets in-flight requests finish, then
+// drains the job queue and waits for the workers, all within timeout
+func shutdown(server *http.Server, timeout time.Duration) {
+	slog.Info("Shutting down, waiting for in-flight work", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server shutdown", "error", err)
+	}
+
+	// No new jobs from here on; workers exit once the queue is drained
+	closeJobQueue()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("All workers finished")
+	case <-ctx.Done():
+		slog.Warn("Timed out waiting for workers to finish")
+	}
 }
 
 func startWorkerPool() {
-	// Start worker goroutines
+	// Start worker goroutines, each with its own fetcher reused across jobs
+	// and retries
 	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
-		go worker(jobQueue)
+		go worker(jobQueue, newTranscriptFetcher())
 	}
 }
 
-func worker(jobs <-chan Job) {
+// enqueueTimeout is how long a job may wait for room in the queue before
+// it's turned away, see ENQUEUE_TIMEOUT_MS
+var enqueueTimeout = time.Second
+
+// enqueueJob submits a job unless the queue has been closed for shutdown.
+// A full queue is waited on for at most enqueueTimeout, or until the job's
+// context ends, so callers never block indefinitely. Holding the read lock
+// while sending keeps closeJobQueue from closing the channel under a blocked
+// sender.
+func enqueueJob(job Job) error {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if queueClosed {
+		return errShuttingDown
+	}
+	select {
+	case jobQueue <- job:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case jobQueue <- job:
+		return nil
+	case <-timer.C:
+		return errQueueFull
+	case <-job.Ctx.Done():
+		return job.Ctx.Err()
+	}
+}
+
+// closeJobQueue stops accepting jobs and lets the workers drain what's left
+func closeJobQueue() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if !queueClosed {
+		queueClosed = true
+		close(jobQueue)
+	}
+}
+
+func worker(jobs <-chan Job, fetcher TranscriptFetcher) {
 	defer wg.Done()
 
 	for job := range jobs {
+		logger := slog.With("request_id", job.RequestID, "video_id", job.VideoID)
+		// Use one dictionary for the whole job even if it's reloaded meanwhile
+		dict := currentDictionary()
 		response := TranscriptResponse{
-			VideoID: job.VideoID,
+			VideoID:     job.VideoID,
+			Tag:         job.Tag,
+			DictVersion: dict.version,
+		}
+
+		// Try the requested languages, then the configured fallbacks
+		transcripts, lang, attempts, err := fetchTranscript(job.Ctx, fetcher, job.VideoID, withFallbackLanguages(job.Languages), job.Options.Captions)
+		response.LanguageAttempts = attempts
+		if err == nil && job.Ctx.Err() != nil {
+			// Everyone gave up while the library call ran, skip the scan
+			err = job.Ctx.Err()
+		}
+		if err != nil {
+			response.Err = classifyFetchError(err)
+			response.Error = fetchErrorMessage(job.VideoID, job.Options.Captions, response.Err)
+			logger.Info("No transcripts found after trying all languages and retries", "error", err)
+		} else {
+			if !job.Options.AllTracks {
+				transcripts = transcripts[:1]
+			}
+			scans := make([]trackScan, 0, len(transcripts))
+			for _, transcript := range transcripts {
+				scan, err := scanTranscript(job, dict, transcript, logger)
+				if err != nil {
+					response.Error = fmt.Sprintf("failed to format transcript: %v", err)
+					logger.Error("Failed to format transcript", "error", err)
+					scans = nil
+					break
+				}
+				scans = append(scans, scan)
+			}
+			if len(scans) > 0 {
+				response = scans[0].response
+				if len(scans) > 1 {
+					response = mergeTrackScans(scans, job.Options)
+				}
+				response.LanguageAttempts = attempts
+				if !response.Profanity {
+					response.CleanConfidence, response.Notes = cleanConfidence(response)
+				}
+				logger.Info("Processed transcript", "lang", lang, "tracks", len(scans), "profanity", response.Profanity)
+				stats.recordResult(response.Profanity)
+			}
 		}
 
-		// Try multiple language codes as fallbacks
-		languagesToTry := job.Languages
-		if len(languagesToTry) == 1 && languagesToTry[0] == "en" {
-			// Add more English variants and common languages as fallbacks
-			languagesToTry = []string{
-				"en", "en-US", "en-GB", "en-CA", "en-AU", "en-IN",
-				"es", "es-ES", "es-MX", "es-AR",
-				"fr", "fr-FR", "fr-CA",
-				"de", "de-DE",
-				"it", "it-IT",
-				"pt", "pt-BR", "pt-PT",
-				"ja", "ko", "zh", "zh-CN", "zh-TW",
-				"hi", "ar", "ru", "nl", "sv", "no", "da", "fi",
+		// Never block on a result nobody is waiting for any more
+		select {
+		case job.Response <- response:
+		case <-job.Ctx.Done():
+			logger.Debug("Dropping result, request is gone")
+		}
+	}
+}
+
+// trackScan is the result of scanning one caption track
+type trackScan struct {
+	response TranscriptResponse
+	counts   map[string]int // Occurrences per dictionary entry
+}
+
+// scanTranscript narrows a transcript down to what the job asked for and
+// scans it. The clean verdict's confidence is left to the caller, which may
+// combine several tracks first.
+func scanTranscript(job Job, dict *dictionary, transcript yt_transcript_models.Transcript, logger *slog.Logger) (trackScan, error) {
+	response := TranscriptResponse{
+		VideoID:     job.VideoID,
+		Tag:         job.Tag,
+		DictVersion: dict.version,
+	}
+	response.SegmentsTotal = len(transcript.Lines)
+	transcript.Lines = selectEdgeSegments(transcript.Lines, job.Options.HeadSeconds, job.Options.TailSeconds)
+	if job.Options.HasRange {
+		var scanned TimeRange
+		transcript.Lines, scanned = selectTimeRange(transcript.Lines, job.Options.RangeStart, job.Options.RangeEnd)
+		response.ScannedRange = &scanned
+	}
+	transcript.Lines, response.Partial = limitSegments(transcript.Lines, maxSegments, segmentLimitMode)
+	response.SegmentsScanned = len(transcript.Lines)
+	if response.Partial {
+		logger.Info("Segment cap reached", "segments_scanned", response.SegmentsScanned,
+			"segments_total", response.SegmentsTotal, "mode", segmentLimitMode)
+	}
+	transcript.Lines, response.Truncated = limitTranscriptChars(transcript.Lines, maxTranscriptChars)
+	if response.Truncated {
+		response.SegmentsScanned = len(transcript.Lines)
+		logger.Info("Transcript length cap reached", "segments_scanned", response.SegmentsScanned,
+			"max_chars", maxTranscriptChars)
+	}
+
+	deduped, overlaps := dedupeSegments(transcript.Lines)
+	response.OverlappingSegments = overlaps
+	if job.Options.Dedupe && overlaps > 0 {
+		transcript.Lines = deduped
+		response.Deduplicated = true
+	}
+
+	// Timestamps are only ever added to the returned text, never scanned
+	formattedText, err := formatTranscript(transcript, false)
+	if err != nil {
+		return trackScan{}, err
+	}
+
+	// Scan with the word list for the language we actually got, which the
+	// fallback cascade may have made a surprise
+	scanLang := transcript.LanguageCode
+	if detectLanguageEnabled {
+		response.DetectedLanguage, response.LanguageConfidence = detectLanguage(formattedText)
+		if response.DetectedLanguage != "" && !sameLanguage(response.DetectedLanguage, scanLang) {
+			logger.Info("Transcript language differs from the caption track, using detected language",
+				"track_lang", scanLang, "detected_lang", response.DetectedLanguage, "confidence", response.LanguageConfidence)
+			scanLang = response.DetectedLanguage
+		} else if response.DetectedLanguage == "" && lowConfidenceLanguage != "" {
+			logger.Info("Transcript language detection isn't confident, using fallback language",
+				"track_lang", scanLang, "fallback_lang", lowConfidenceLanguage, "confidence", response.LanguageConfidence)
+			scanLang = lowConfidenceLanguage
+		}
+	}
+	langDict := dict.forLanguage(scanLang)
+	response.Language = transcript.LanguageCode
+	response.CaptionType = transcriptKind(transcript)
+	matches := findProfanity(langDict, formattedText, job.Options.Match)
+	if job.Options.Transcript || job.Options.Offsets {
+		response.Transcript = formattedText
+		if job.Options.Timestamps {
+			if response.Transcript, err = formatTranscript(transcript, true); err != nil {
+				return trackScan{}, err
 			}
 		}
+	}
+	if job.Options.Offsets {
+		response.MatchOffsets = matches.offsets()
+	}
+	if job.Options.CompareNormalization {
+		response.NormalizationComparison = compareNormalization(langDict, formattedText, matches, job.Options)
+	}
+	response.ProfanityDensity = matches.density()
+	response.Profanity = meetsThreshold(matches.hits, response.ProfanityDensity,
+		job.Options.MinHits, job.Options.MinDensity)
+	response.ProfaneWords = matches.words
+	response.ProfanityCount = matches.hits
+	response.WordsScanned = matches.wordCount
+	response.WordCounts = matches.breakdown(langDict)
+	response.MaxSeverity = matches.severity
+	response.Categories = matches.categories
+	response.ProfanitySegments = profanitySegments(langDict, transcript.Lines, job.Options.Match)
+	if job.Options.ContextWindow > 0 {
+		response.Contexts = matches.contexts(job.Options.ContextWindow)
+	}
+	response.SeverityScore = repetitionScore(matches.counts, repetitionExponent)
+	response.AudienceRating = rateAudience(response.SeverityScore, audienceRatings)
+	response.ProfanityScore = profanityScore(matches.hits, response.ProfanityDensity,
+		matches.severity, profanityScoreWeights)
+	return trackScan{response: response, counts: matches.counts}, nil
+}
+
+var (
+	// errTranscriptPanic wraps a panic recovered from the transcript library
+	errTranscriptPanic = errors.New("transcript library panicked")
+	// errEmptyTranscript is returned when the library reports success but
+	// hands back nothing we can scan
+	errEmptyTranscript = errors.New("no transcripts with usable lines were returned")
+	// errCaptionKindMissing is returned when a language only has captions of
+	// a kind the scan excluded, see ScanOptions.Captions
+	errCaptionKindMissing = errors.New("no captions of the requested kind")
+)
+
+// Failures a check can end in besides the fetch errors above, so handlers
+// can pick a status code with errors.Is, see errorStatusCode
+var (
+	errNoCaptions       = errors.New("video has no captions")
+	errPrivateVideo     = errors.New("video is private")
+	errVideoUnavailable = errors.New("video is unavailable")
+	errServerBusy       = errors.New("job queue is too deep")
+	errQueueFull        = errors.New("timed out waiting for room in the job queue")
+	errShuttingDown     = errors.New("server is shutting down")
+	errNoDictionary     = errors.New("profanity dictionary is not loaded")
+)
 
-		var lastError error
-		var foundTranscript bool
-		maxRetries := 3
+// AttemptResult records how fetching one language went
+type AttemptResult struct {
+	Language string `json:"language"`
+	Found    bool   `json:"found"`
+	Attempts int    `json:"attempts"`        // Requests made, including retries
+	Error    string `json:"error,omitempty"` // Why the last request failed
+}
 
-		// Try each language with retry logic
-		for _, lang := range languagesToTry {
-			log.Printf("Attempting to fetch transcript for video %s with language: %s", job.VideoID, lang)
+// maxFetchAttempts is how often one language is tried when the network fails
+const maxFetchAttempts = 3
 
-			// Rate limit requests to avoid overwhelming YouTube's servers
-			<-rateLimiter.C
+// fetchTranscript returns the tracks of the first language in langs that has
+// any, tried in order, together with that language. Network errors are
+// retried with backoff until maxFetchAttempts or the retry budget runs out;
+// so are blocks while another proxy is available, see proxyPool. Any other
+// failure, such as the captions not existing in that language, moves on to
+// the next language straight away. Only tracks of the given caption kind are
+// accepted. The error of the last attempt is returned when every language
+// fails, unless some language only lacked the wanted kind. The outcome for
+// each language tried is returned either way.
+func fetchTranscript(ctx context.Context, fetcher TranscriptFetcher, videoID string, langs []string, captions captionKind) ([]yt_transcript_models.Transcript, string, []AttemptResult, error) {
+	logger := requestLogger(ctx).With("video_id", videoID)
+	retryDelays := newBackoff()
+	lastError := errors.New("no languages to try")
+	var kindError error
+	var results []AttemptResult
 
-			// Retry logic for each language
-			for attempt := 0; attempt < maxRetries; attempt++ {
-				if attempt > 0 {
-					// Add exponential backoff delay
-					delay := time.Duration(math.Pow(2, float64(attempt))) * time.Second
-					log.Printf("Retrying after %v delay (attempt %d/%d)", delay, attempt+1, maxRetries)
-					time.Sleep(delay)
-				}
+	for _, lang := range langs {
+		// Stop early if the caller went away
+		if err := ctx.Err(); err != nil {
+			return nil, "", results, err
+		}
 
-				client := yt_transcript.NewClient()
-				transcripts, err := client.GetTranscripts(job.VideoID, []string{lang})
+		logger.Debug("Attempting to fetch transcript", "lang", lang)
 
-				if err != nil {
-					lastError = err
-					log.Printf("Attempt %d failed to get transcript for video %s with language %s: %v",
-						attempt+1, job.VideoID, lang, err)
-
-					// Check if it's a temporary error that might benefit from retry
-					errorStr := strings.ToLower(err.Error())
-					if strings.Contains(errorStr, "timeout") ||
-						strings.Contains(errorStr, "connection") ||
-						strings.Contains(errorStr, "network") ||
-						strings.Contains(errorStr, "temporary") {
-						// Retry for network-related errors
-						continue
-					}
-
-					// If it's a "captions not found" error, try next language immediately
-					if strings.Contains(errorStr, "captions not found") {
-						break // Break from retry loop, try next language
-					}
-
-					// For other errors, retry might help
-					if attempt < maxRetries-1 {
-						continue
-					}
-
-					// If all retries failed, break from retry loop
+		// Rate limit requests to avoid overwhelming YouTube's servers
+		if err := waitForRateLimit(ctx); err != nil {
+			return nil, "", results, err
+		}
+
+		results = append(results, AttemptResult{Language: lang})
+		result := &results[len(results)-1]
+		for attempt := 0; attempt < maxFetchAttempts; attempt++ {
+			if attempt > 0 {
+				// Back off exponentially, unless the job is out of retry time
+				delay, ok := retryDelays.next(attempt)
+				if !ok {
+					logger.Debug("Retry budget used up", "lang", lang, "max_retry_duration", maxRetryDuration)
 					break
 				}
-
-				// Success case
-				if len(transcripts) > 0 {
-					log.Printf("Successfully fetched transcript for video %s with language: %s (attempt %d)",
-						job.VideoID, lang, attempt+1)
-
-					formatter := yt_transcript_formatters.NewTextFormatter(
-						yt_transcript_formatters.WithTimestamps(false),
-					)
-					formattedText, err := formatter.Format([]yt_transcript_models.Transcript{transcripts[0]})
-					if err != nil {
-						response.Error = fmt.Sprintf("failed to format transcript: %v", err)
-						log.Printf("Failed to format transcript for video %s: %v", job.VideoID, err)
-					} else {
-						response.Profanity = containsProfanity(formattedText)
-						log.Printf("Successfully processed transcript for video %s, profanity detected: %v",
-							job.VideoID, response.Profanity)
-						foundTranscript = true
-					}
-					break // Break from retry loop
+				logger.Debug("Retrying after delay", "lang", lang, "delay", delay, "attempt", attempt+1, "max_attempts", maxFetchAttempts)
+				if err := retrySleep(ctx, delay); err != nil {
+					return nil, "", results, err
 				}
 			}
 
-			if foundTranscript {
-				break // Break from language loop
+			release, err := acquireOutbound(ctx)
+			if err != nil {
+				return nil, "", results, err
+			}
+			result.Attempts++
+			transcripts, err := fetchLanguage(fetcher, videoID, lang, captions)
+			release()
+			if err == nil {
+				logger.Debug("Fetched transcript", "lang", lang, "attempt", attempt+1, "tracks", len(transcripts))
+				result.Found = true
+				result.Error = ""
+				return transcripts, lang, results, nil
 			}
-		}
 
-		if !foundTranscript && response.Error == "" {
-			if lastError != nil {
-				// Provide more helpful error messages based on the error type
-				errorStr := strings.ToLower(lastError.Error())
-				if strings.Contains(errorStr, "captions not found") {
-					response.Error = fmt.Sprintf("No captions/transcripts are available for video %s. This video may not have auto-generated or manual captions enabled.", job.VideoID)
-				} else if strings.Contains(errorStr, "private") {
-					response.Error = fmt.Sprintf("Video %s is private and transcripts cannot be accessed.", job.VideoID)
-				} else if strings.Contains(errorStr, "unavailable") {
-					response.Error = fmt.Sprintf("Video %s is unavailable or has been removed.", job.VideoID)
-				} else {
-					response.Error = fmt.Sprintf("Failed to fetch transcripts for video %s: %v", job.VideoID, lastError)
-				}
-			} else {
-				response.Error = fmt.Sprintf("No transcripts found for video %s in any of the attempted languages: %v",
-					job.VideoID, languagesToTry)
+			result.Error = err.Error()
+			lastError = err
+			if errors.Is(err, errCaptionKindMissing) {
+				kindError = err
+			}
+			errorType := fetchErrorType(err)
+			fetchFailures.WithLabelValues(errorType).Inc()
+			stats.recordFetchFailure(errorType)
+			logger.Debug("Failed to get transcript", "lang", lang, "attempt", attempt+1, "error", err)
+
+			if errors.Is(err, errYouTubeThrottled) && youtubeProxies.available() {
+				// The block is likely tied to the proxy's address, retry
+				// through the next one
+				logger.Info("YouTube blocked the request, retrying through another proxy", "lang", lang, "error", err)
+				continue
+			}
+			if errors.Is(err, errYouTubeThrottled) {
+				// Every other language would hit the same wall
+				logger.Warn("YouTube is throttling transcript requests", "lang", lang, "error", err)
+				return nil, "", results, err
+			}
+
+			if !isNetworkError(err) {
+				break // Retrying won't help, try the next language
 			}
-			log.Printf("No transcripts found for video %s after trying all languages and retries", job.VideoID)
 		}
+	}
+	if kindError != nil {
+		lastError = kindError
+	}
+	return nil, "", results, lastError
+}
+
+// isNetworkError reports whether a fetch failed for transient reasons that a
+// retry might fix
+func isNetworkError(err error) bool {
+	if errors.Is(err, errTranscriptPanic) || errors.Is(err, errEmptyTranscript) ||
+		errors.Is(err, errCaptionKindMissing) || errors.Is(err, errYouTubeThrottled) {
+		return false
+	}
+	errorStr := strings.ToLower(err.Error())
+	return strings.Contains(errorStr, "timeout") ||
+		strings.Contains(errorStr, "connection") ||
+		strings.Contains(errorStr, "network") ||
+		strings.Contains(errorStr, "temporary")
+}
+
+// fetchErrorMessage explains why no transcript could be fetched for a video
+func fetchErrorMessage(videoID string, captions captionKind, err error) string {
+	switch {
+	case errors.Is(err, errYouTubeThrottled):
+		return fmt.Sprintf("YouTube is throttling requests from this server, could not check video %s. Please retry later.", videoID)
+	case errors.Is(err, errCaptionKindMissing):
+		return fmt.Sprintf("No %s captions found for video %s in any of the attempted languages.", captions, videoID)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Sprintf("Timed out checking video %s", videoID)
+	case errors.Is(err, context.Canceled):
+		return fmt.Sprintf("Request for video %s was cancelled", videoID)
+	case errors.Is(err, errNoCaptions):
+		return fmt.Sprintf("No captions/transcripts are available for video %s. This video may not have auto-generated or manual captions enabled.", videoID)
+	case errors.Is(err, errPrivateVideo):
+		return fmt.Sprintf("Video %s is private and transcripts cannot be accessed.", videoID)
+	case errors.Is(err, errVideoUnavailable):
+		return fmt.Sprintf("Video %s is unavailable or has been removed.", videoID)
+	default:
+		return fmt.Sprintf("Failed to fetch transcripts for video %s: %v", videoID, err)
+	}
+}
 
-		job.Response <- response
+// classifyFetchError wraps a transcript library error in the matching check
+// error. The library only tells these apart by message, so this is the one
+// place that looks at the text.
+func classifyFetchError(err error) error {
+	if errors.Is(err, errYouTubeThrottled) || errors.Is(err, errCaptionKindMissing) ||
+		errors.Is(err, errNoCaptions) || errors.Is(err, errPrivateVideo) || errors.Is(err, errVideoUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	errorStr := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(errorStr, "captions not found"),
+		strings.Contains(errorStr, "playercaptionstracklistrenderer not found"),
+		strings.Contains(errorStr, "no transcript found"):
+		return fmt.Errorf("%w: %w", errNoCaptions, err)
+	case strings.Contains(errorStr, "private"):
+		return fmt.Errorf("%w: %w", errPrivateVideo, err)
+	case strings.Contains(errorStr, "unavailable"):
+		return fmt.Errorf("%w: %w", errVideoUnavailable, err)
 	}
+	return err
+}
+
+// fetchLanguage fetches every usable track of a single language, manual
+// captions first, and guards against the library misbehaving: panics are
+// recovered into errTranscriptPanic and results with no usable lines are
+// turned into errEmptyTranscript. Usable tracks of the wrong caption kind
+// yield errCaptionKindMissing.
+func fetchLanguage(fetcher TranscriptFetcher, videoID, lang string, captions captionKind) (usable []yt_transcript_models.Transcript, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered panic fetching transcript", "video_id", videoID, "lang", lang, "panic", r)
+			err = fmt.Errorf("%w for language %s: %v", errTranscriptPanic, lang, r)
+		}
+	}()
+
+	transcripts, err := fetcher.GetTranscripts(videoID, []string{lang})
+	if err != nil {
+		return nil, err
+	}
+
+	wrongKind := false
+	for _, candidate := range transcripts {
+		candidate.Lines = sanitizeLines(candidate.Lines)
+		if len(candidate.Lines) == 0 {
+			continue
+		}
+		if captions != captionsAny && transcriptKind(candidate) != captions {
+			wrongKind = true
+			continue
+		}
+		usable = append(usable, candidate)
+	}
+	if len(usable) > 0 {
+		// The library returns tracks in whatever order they downloaded
+		slices.SortStableFunc(usable, func(a, b yt_transcript_models.Transcript) int {
+			return cmp.Compare(trackRank(a), trackRank(b))
+		})
+		return usable, nil
+	}
+	if wrongKind {
+		return nil, fmt.Errorf("%w: language %s has no %s captions", errCaptionKindMissing, lang, captions)
+	}
+	return nil, errEmptyTranscript
+}
+
+// trackRank orders manual captions, which are usually more accurate, before
+// auto-generated ones
+func trackRank(transcript yt_transcript_models.Transcript) int {
+	if transcriptKind(transcript) == captionsManual {
+		return 0
+	}
+	return 1
+}
+
+// sanitizeLines drops lines with no text or nonsensical timing
+func sanitizeLines(lines []yt_transcript_models.TranscriptLine) []yt_transcript_models.TranscriptLine {
+	clean := make([]yt_transcript_models.TranscriptLine, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line.Text) == "" {
+			continue
+		}
+		if math.IsNaN(line.Start) || math.IsInf(line.Start, 0) || line.Start < 0 {
+			continue
+		}
+		if math.IsNaN(line.Duration) || math.IsInf(line.Duration, 0) || line.Duration < 0 {
+			line.Duration = 0
+		}
+		clean = append(clean, line)
+	}
+	return clean
+}
+
+// formatTranscript flattens a transcript to plain text, optionally starting
+// each line with its start time, recovering from formatter panics
+func formatTranscript(transcript yt_transcript_models.Transcript, timestamps bool) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w while formatting: %v", errTranscriptPanic, r)
+		}
+	}()
+
+	formatter := yt_transcript_formatters.NewTextFormatter(
+		yt_transcript_formatters.WithTimestamps(timestamps),
+	)
+	return formatter.Format([]yt_transcript_models.Transcript{transcript})
 }
 
 func getTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	if wantsPlainText(r) {
+		response, ok := checkVideo(w, r, writePlainTextError)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if response.Profanity {
+			writeWithETag(w, r, []byte("profane\n"))
+		} else {
+			writeWithETag(w, r, []byte("clean\n"))
+		}
+		return
+	}
+
+	response, ok := checkVideo(w, r, writeErrorResponse)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, response)
+}
+
+// wantsPlainText reports whether the client asked for the bare verdict,
+// "profane" or "clean", with ?format=text or Accept: text/plain. Handy in
+// shell pipelines where parsing JSON is a chore.
+func wantsPlainText(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "text"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+// errorWriter writes an error response in the format the client asked for
+type errorWriter func(w http.ResponseWriter, status int, response ErrorResponse)
+
+// checkVideo runs the check requested by a single video handler and sets the
+// response headers. If it fails the error response has already been written
+// with writeError and ok is false.
+func checkVideo(w http.ResponseWriter, r *http.Request, writeError errorWriter) (response TranscriptResponse, ok bool) {
+	logger := requestLogger(r.Context())
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get video ID from query parameters
+	// Get video ID from the path, or from ?url= for full YouTube URLs whose
+	// slashes can't live in a path segment
 	vars := mux.Vars(r)
-	videoID, ok := vars["video_id"]
-	if !ok || videoID == "" {
-		log.Printf("Missing video_id in request")
-		http.Error(w, "Missing video_id in URL", http.StatusBadRequest)
-		return
+	rawVideoID, ok := vars["video_id"]
+	if !ok || rawVideoID == "" {
+		rawVideoID = r.URL.Query().Get("url")
+	}
+	if rawVideoID == "" {
+		logger.Debug("Missing video_id in request")
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: "Missing video_id in URL"})
+		return response, false
+	}
+	videoID, err := extractVideoID(rawVideoID)
+	if err != nil {
+		logger.Debug("Invalid video ID in request", "video_id", rawVideoID)
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid video ID or YouTube URL %q: %v", rawVideoID, err)})
+		return response, false
 	}
 
-	// Get language from query parameters, default to English if not specified
-	langParam := r.URL.Query().Get("lang")
-	languages := []string{"en"}
-	if langParam != "" {
-		languages = []string{langParam}
+	languages := requestLanguages(r)
+
+	options, err := parseScanOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return response, false
 	}
 
-	log.Printf("Processing request for video: %s, language: %v", videoID, languages)
+	if status, message := dictionaryError(r.URL.Query().Get("dict_version")); status != 0 {
+		writeError(w, status, ErrorResponse{Error: message})
+		return response, false
+	}
 
-	// Create response channel
-	respChan := make(chan TranscriptResponse, 1)
+	logger.Info("Processing request", "video_id", videoID, "lang", languages)
 
-	// Submit job to the worker pool
-	jobQueue <- Job{
-		VideoID:   videoID,
-		Languages: languages,
-		Response:  respChan,
+	// Metadata is looked up alongside the transcript and simply left out if
+	// it fails or is slow
+	var metadataChan chan *VideoMetadata
+	if r.URL.Query().Get("metadata") == "true" {
+		metadataChan = make(chan *VideoMetadata, 1)
+		go func() {
+			metadata, err := fetchVideoMetadata(r.Context(), videoID)
+			if err != nil {
+				logger.Warn("Omitting metadata", "video_id", videoID, "error", err)
+			}
+			metadataChan <- metadata
+		}()
 	}
 
-	// Wait for response
-	response := <-respChan
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	response = runJob(Job{
+		Ctx:       ctx,
+		VideoID:   videoID,
+		Languages: languages,
+		Options:   options,
+		Tag:       r.URL.Query().Get("tag"),
+	})
 
 	if response.Error != "" {
-		log.Printf("Error processing video %s: %s", videoID, response.Error)
-		w.Header().Set("Content-Type", "application/json")
-
-		// Provide more specific status codes based on error type
-		if strings.Contains(strings.ToLower(response.Error), "no transcripts") {
-			w.WriteHeader(http.StatusNotFound)
-		} else if strings.Contains(strings.ToLower(response.Error), "captions not found") {
-			w.WriteHeader(http.StatusNotFound)
-		} else if strings.Contains(strings.ToLower(response.Error), "private") ||
-			strings.Contains(strings.ToLower(response.Error), "unavailable") {
-			w.WriteHeader(http.StatusForbidden)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+		logger.Warn("Error processing video", "video_id", videoID, "error", response.Error)
+		status := errorStatusCode(response.Err)
+		if errors.Is(response.Err, errServerBusy) || errors.Is(response.Err, errQueueFull) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds()))
+		} else if errors.Is(response.Err, errYouTubeThrottled) {
+			setThrottleRetryAfter(w)
 		}
+		writeError(w, status, ErrorResponse{Error: response.Error, LanguageAttempts: response.LanguageAttempts})
+		return response, false
+	}
 
-		json.NewEncoder(w).Encode(ErrorResponse{Error: response.Error})
-		return
+	if metadataChan != nil {
+		response.Metadata = <-metadataChan
 	}
 
 	// Return response
-	log.Printf("Returning response for video %s: profanity=%v", videoID, response.Profanity)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	logger.Info("Returning response", "video_id", videoID, "profanity", response.Profanity)
+	if response.Cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("X-Dictionary-Version", response.DictVersion)
+	return response, true
 }
 
-func loadProfanityWords(filename string) error {
-	profanityWords = make(map[string]struct{})
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
+// requestLanguages reads the lang query parameters in order. Clients can repeat
+// the parameter (?lang=en&lang=es&lang=fr) and each language is tried in turn;
+// the first one that yields a transcript wins. With no lang English is
+// requested. Either way fallbackLanguages are tried afterwards.
+func requestLanguages(r *http.Request) []string {
+	var languages []string
+	for _, lang := range r.URL.Query()["lang"] {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	if len(languages) == 0 {
+		return []string{"en"}
+	}
+	return languages
+}
+
+// fallbackLanguages are tried, in order, after the requested languages have
+// all failed. FALLBACK_LANGUAGES replaces the list (comma separated), "none"
+// disables fallbacks.
+var fallbackLanguages = []string{
+	"en", "en-US", "en-GB", "en-CA", "en-AU", "en-IN",
+	"es", "es-ES", "es-MX", "es-AR",
+	"fr", "fr-FR", "fr-CA",
+	"de", "de-DE",
+	"it", "it-IT",
+	"pt", "pt-BR", "pt-PT",
+	"ja", "ko", "zh", "zh-CN", "zh-TW",
+	"hi", "ar", "ru", "nl", "sv", "no", "da", "fi",
+}
+
+// parseFallbackLanguages reads the FALLBACK_LANGUAGES format
+func parseFallbackLanguages(raw string) []string {
+	if raw == "none" {
+		return nil
+	}
+	var languages []string
+	for _, lang := range strings.Split(raw, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// withFallbackLanguages returns the requested languages followed by the
+// fallbacks that weren't requested already
+func withFallbackLanguages(requested []string) []string {
+	languages := slices.Clone(requested)
+	for _, lang := range fallbackLanguages {
+		if !slices.Contains(languages, lang) {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// parseScanOptions reads the per-request scan settings from query string
+// parameters. GraphQL options are mapped onto the same parameters, see
+// graphqlQueryParams, so both are validated alike.
+func parseScanOptions(query url.Values) (ScanOptions, error) {
+	options := defaultScanOptions()
+	var err error
+	if options.HeadSeconds, err = parseSecondsParam(query, "head_seconds"); err != nil {
+		return options, err
+	}
+	if options.TailSeconds, err = parseSecondsParam(query, "tail_seconds"); err != nil {
+		return options, err
+	}
+	if options.RangeStart, err = parseSecondsParam(query, "start"); err != nil {
+		return options, err
+	}
+	if options.RangeEnd, err = parseSecondsParam(query, "end"); err != nil {
+		return options, err
+	}
+	options.HasRange = query.Has("start") || query.Has("end")
+	if err := validateRange(options); err != nil {
+		return options, err
+	}
+	if raw := query.Get("dedupe"); raw != "" {
+		if options.Dedupe, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("dedupe must be true or false")
+		}
+	}
+	if raw := query.Get("min_hits"); raw != "" {
+		if options.MinHits, err = strconv.Atoi(raw); err != nil || options.MinHits < 1 {
+			return options, fmt.Errorf("min_hits must be a positive integer")
+		}
+	}
+	if raw := query.Get("min_density"); raw != "" {
+		if options.MinDensity, err = strconv.ParseFloat(raw, 64); err != nil || !(options.MinDensity >= 0 && options.MinDensity <= 1) {
+			return options, fmt.Errorf("min_density must be a fraction between 0 and 1")
+		}
+	}
+	if raw := query.Get("include_transcript"); raw != "" {
+		if options.Transcript, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("include_transcript must be true or false")
+		}
+	}
+	if raw := query.Get("include_offsets"); raw != "" {
+		if options.Offsets, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("include_offsets must be true or false")
+		}
+	}
+	if raw := query.Get("timestamps"); raw != "" {
+		if options.Timestamps, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("timestamps must be true or false")
+		}
+	}
+	if options.Timestamps && options.Offsets {
+		// Offsets index the scanned text, which never has timestamps
+		return options, fmt.Errorf("timestamps can't be combined with include_offsets=true")
+	}
+	if raw := query.Get("compare_normalization"); raw != "" {
+		if options.CompareNormalization, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("compare_normalization must be true or false")
+		}
+		if options.CompareNormalization && !debugEnabled {
+			return options, fmt.Errorf("compare_normalization is only available with DEBUG=true")
+		}
+	}
+	if raw := query.Get("no_cache"); raw != "" {
+		if options.NoCache, err = strconv.ParseBool(raw); err != nil {
+			return options, fmt.Errorf("no_cache must be true or false")
+		}
+	}
+	if raw := query.Get("match_mode"); raw != "" {
+		if options.Match.Mode, err = parseMatchMode(raw); err != nil {
+			return options, err
+		}
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		word := strings.TrimSpace(scanner.Text())
-		if word != "" {
-			profanityWords[strings.ToLower(word)] = struct{}{}
+	if raw := query.Get("context_window"); raw != "" {
+		if options.ContextWindow, err = strconv.Atoi(raw); err != nil || options.ContextWindow < 0 || options.ContextWindow > maxContextWindow {
+			return options, fmt.Errorf("context_window must be an integer between 0 and %d", maxContextWindow)
 		}
 	}
-	return scanner.Err()
+	if raw := query.Get("captions"); raw != "" {
+		if options.Captions, err = parseCaptionKind(raw); err != nil {
+			return options, err
+		}
+	}
+	switch query.Get("tracks") {
+	case "", "first":
+	case "all":
+		options.AllTracks = true
+	default:
+		return options, fmt.Errorf("tracks must be first or all")
+	}
+	options.Match.Allow = parseAllowParam(query.Get("allow"))
+	return options, nil
+}
+
+// checkDictionary rejects a request the loaded dictionary can't answer, see
+// dictionaryError
+func checkDictionary(w http.ResponseWriter, r *http.Request) bool {
+	if status, message := dictionaryError(r.URL.Query().Get("dict_version")); status != 0 {
+		writeJSONError(w, status, message)
+		return false
+	}
+	return true
+}
+
+// dictionaryError returns 503 while no dictionary is loaded, see
+// DICTIONARY_FALLBACK, and enforces an optional dict_version pin. Only the
+// currently loaded dictionary is available, so a pin on any other version is
+// rejected with 409 rather than silently answering under a different word
+// list. The status is 0 when the request can go ahead.
+func dictionaryError(pinned string) (int, string) {
+	if !dictionaryLoaded() {
+		return http.StatusServiceUnavailable, errDictionaryNotLoaded
+	}
+	active := currentDictionary().version
+	if pinned == "" || pinned == active {
+		return 0, ""
+	}
+	return http.StatusConflict, fmt.Sprintf("Requested dictionary version %s is not available, the active version is %s", pinned, active)
+}
+
+// inflight coalesces identical jobs that are running at the same time
+var inflight singleflight.Group
+
+// sharedJob is the context of an in-flight job and how many callers are
+// waiting on it
+type sharedJob struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// sharedJobs tracks the callers of each in-flight job so it can be cancelled
+// once every one of them has given up
+var sharedJobs = struct {
+	sync.Mutex
+	jobs map[string]*sharedJob
+}{jobs: make(map[string]*sharedJob)}
+
+// joinSharedJob registers a caller of the job for key. The first caller's
+// context provides the values, not the cancellation, of the job's context.
+func joinSharedJob(key string, ctx context.Context) *sharedJob {
+	sharedJobs.Lock()
+	defer sharedJobs.Unlock()
+	shared, ok := sharedJobs.jobs[key]
+	if !ok {
+		shared = &sharedJob{}
+		shared.ctx, shared.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		sharedJobs.jobs[key] = shared
+	}
+	shared.waiters++
+	return shared
+}
+
+// leaveSharedJob unregisters a caller. When the last caller abandons the job
+// it is cancelled, and forgotten so later callers start a fresh one instead
+// of getting the cancellation.
+func leaveSharedJob(key string, shared *sharedJob, abandoned bool) {
+	sharedJobs.Lock()
+	defer sharedJobs.Unlock()
+	shared.waiters--
+	if shared.waiters > 0 {
+		return
+	}
+	if sharedJobs.jobs[key] == shared {
+		delete(sharedJobs.jobs, key)
+	}
+	if abandoned {
+		inflight.Forget(key)
+	}
+	shared.cancel()
+}
+
+// runJob submits a job to the worker pool and waits for its result
+func runJob(job Job) TranscriptResponse {
+	if job.Ctx == nil {
+		job.Ctx = context.Background()
+	}
+	if job.RequestID == "" {
+		job.RequestID = requestIDFrom(job.Ctx)
+	}
+	if !dictionaryLoaded() {
+		return TranscriptResponse{VideoID: job.VideoID, Tag: job.Tag, Error: errDictionaryNotLoaded, Err: errNoDictionary}
+	}
+
+	// Serve from the cache when we've already checked this video
+	key := cacheKey(job)
+	if cache != nil && !skipsCache(job) {
+		if response, ok := cache.get(key); ok {
+			cacheLookups.WithLabelValues("hit").Inc()
+			stats.cacheHits.Add(1)
+			requestLogger(job.Ctx).Debug("Cache hit", "video_id", job.VideoID)
+			response.Tag = job.Tag
+			response.Cached = true
+			return response
+		}
+		cacheLookups.WithLabelValues("miss").Inc()
+		stats.cacheMisses.Add(1)
+	}
+
+	// Concurrent requests for the same scan share a single job. Each caller
+	// still gives up on its own deadline; the shared job keeps running for
+	// the others and stops once nobody is left waiting.
+	shared := joinSharedJob(key, job.Ctx)
+	results := inflight.DoChan(key, func() (interface{}, error) {
+		return dispatchJob(job, key, shared.ctx), nil
+	})
+	select {
+	case result := <-results:
+		leaveSharedJob(key, shared, false)
+		response := result.Val.(TranscriptResponse)
+		response.Tag = job.Tag
+		if result.Shared {
+			requestLogger(job.Ctx).Debug("Shared in-flight result", "video_id", job.VideoID)
+		}
+		return response
+	case <-job.Ctx.Done():
+		leaveSharedJob(key, shared, true)
+		return abandonedResponse(job)
+	}
+}
+
+// abandonedResponse is the result for a job whose context ended first
+func abandonedResponse(job Job) TranscriptResponse {
+	response := TranscriptResponse{VideoID: job.VideoID, Tag: job.Tag, Err: job.Ctx.Err()}
+	if errors.Is(job.Ctx.Err(), context.DeadlineExceeded) {
+		response.Error = fmt.Sprintf("Timed out checking video %s", job.VideoID)
+	} else {
+		response.Error = fmt.Sprintf("Request for video %s was cancelled", job.VideoID)
+	}
+	return response
 }
 
-func containsProfanity(text string) bool {
-	words := strings.Fields(strings.ToLower(text))
-	for _, word := range words {
-		if _, exists := profanityWords[word]; exists {
-			return true
+// dispatchJob runs a job on the worker pool and caches a successful result.
+// The job runs under the shared context from joinSharedJob rather than the
+// first caller's, since other callers may be waiting on it too, and is
+// bounded by requestTimeout.
+func dispatchJob(job Job, key string, sharedCtx context.Context) TranscriptResponse {
+	ctx, cancel := context.WithTimeout(sharedCtx, requestTimeout)
+	defer cancel()
+	job.Ctx = ctx
+	job.Response = make(chan TranscriptResponse, 1)
+
+	if depth := len(jobQueue); depth >= queueRejectDepth {
+		requestLogger(job.Ctx).Warn("Rejecting job, queue is full", "video_id", job.VideoID, "queue_depth", depth)
+		queueRejections.WithLabelValues("depth").Inc()
+		return TranscriptResponse{
+			VideoID: job.VideoID,
+			Tag:     job.Tag,
+			Error:   "Server is busy, please retry later",
+			Err:     errServerBusy,
 		}
 	}
-	return false
+
+	// Submit job to the worker pool
+	switch err := enqueueJob(job); {
+	case errors.Is(err, errShuttingDown):
+		return TranscriptResponse{
+			VideoID: job.VideoID,
+			Tag:     job.Tag,
+			Error:   "Server is shutting down, please retry shortly",
+			Err:     errShuttingDown,
+		}
+	case errors.Is(err, errQueueFull):
+		requestLogger(job.Ctx).Warn("Rejecting job, timed out waiting for room in the queue",
+			"video_id", job.VideoID, "enqueue_timeout", enqueueTimeout)
+		queueRejections.WithLabelValues("timeout").Inc()
+		return TranscriptResponse{
+			VideoID: job.VideoID,
+			Tag:     job.Tag,
+			Error:   "Server is overloaded, please retry later",
+			Err:     errQueueFull,
+		}
+	case err != nil:
+		return abandonedResponse(job)
+	}
+
+	// The response channel is buffered so the worker never blocks on a send
+	// if we've stopped waiting
+	select {
+	case response := <-job.Response:
+		if cache != nil && !skipsCache(job) {
+			cache.set(key, response)
+		}
+		return response
+	case <-ctx.Done():
+		return abandonedResponse(job)
+	}
+}
+
+// waitForRateLimit blocks until the rate limiter allows another request to
+// YouTube or the context is done
+func waitForRateLimit(ctx context.Context) error {
+	return rateLimiter.Wait(ctx)
+}
+
+// sleepContext sleeps for d unless the context is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errorStatusCode picks the HTTP status for a failed check's Err
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, errShuttingDown), errors.Is(err, errYouTubeThrottled),
+		errors.Is(err, errNoDictionary), errors.Is(err, errQueueFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errServerBusy):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errNoCaptions), errors.Is(err, errCaptionKindMissing),
+		errors.Is(err, errEmptyTranscript):
+		return http.StatusNotFound
+	case errors.Is(err, errPrivateVideo), errors.Is(err, errVideoUnavailable):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// throttleRetryAfter is the Retry-After sent when YouTube is throttling us,
+// see THROTTLE_RETRY_AFTER_SECONDS
+var throttleRetryAfter = 60 * time.Second
+
+// setThrottleRetryAfter tells clients to wait out YouTube's throttling
+func setThrottleRetryAfter(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(throttleRetryAfter/time.Second)))
+}
+
+// retryAfterSeconds estimates how long until the queued jobs have started,
+// given the rate limit, for a Retry-After header
+func retryAfterSeconds() int {
+	seconds := float64(len(jobQueue)) / float64(rateLimiter.Limit())
+	return max(1, int(math.Ceil(seconds)))
+}
+
+// validateRange checks the start/end window of a scan
+func validateRange(options ScanOptions) error {
+	if !options.HasRange {
+		return nil
+	}
+	if options.HeadSeconds > 0 || options.TailSeconds > 0 {
+		return errors.New("start and end can't be combined with head_seconds or tail_seconds")
+	}
+	if options.RangeEnd > 0 && options.RangeStart >= options.RangeEnd {
+		return errors.New("start must be less than end")
+	}
+	return nil
+}
+
+// parseSecondsParam reads an optional non-negative number of seconds from the
+// query string, returning 0 when the parameter is absent
+func parseSecondsParam(query url.Values, name string) (float64, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil || seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, fmt.Errorf("%s must be a non-negative number of seconds", name)
+	}
+	return seconds, nil
+}
+
+// writeJSONError writes an ErrorResponse with the given status code
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeErrorResponse(w, status, ErrorResponse{Error: message})
+}
+
+// writeErrorResponse is writeJSONError for errors carrying more detail
+func writeErrorResponse(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writePlainTextError writes just the message, prefixed with "error: ", for
+// clients of the plain text verdict
+func writePlainTextError(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Dictionary-Version", currentDictionary().version)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "error: %s\n", response.Error)
 }
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	rateLimiter = rate.NewLimiter(rate.Inf, 1)
+	dict, err := loadMainDictionary()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loading dictionary:", err)
+		os.Exit(1)
+	}
+	setDictionary(dict)
+	os.Exit(m.Run())
+}
+
+// fetcherFunc adapts a function to TranscriptFetcher
+type fetcherFunc func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error)
+
+func (f fetcherFunc) GetTranscripts(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+	return f(videoID, langs)
+}
+
+// failingFetcher fails every fetch with the given library error message
+func failingFetcher(message string) fetcherFunc {
+	return func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return nil, errors.New(message)
+	}
+}
+
+// testTranscript builds a transcript with one line per text, a second apart
+func testTranscript(lang string, kind captionKind, texts ...string) yt_transcript_models.Transcript {
+	transcript := yt_transcript_models.Transcript{
+		LanguageCode: lang,
+		IsGenerated:  kind == captionsManual, // Inverted, see transcriptKind
+	}
+	for i, text := range texts {
+		transcript.Lines = append(transcript.Lines, yt_transcript_models.TranscriptLine{
+			Text: text, Start: float64(i), Duration: 1,
+		})
+	}
+	return transcript
+}
+
+// startTestWorkers swaps in a fresh job queue served by maxWorkers workers
+// using fetcher, restoring the old queue when the test ends
+func startTestWorkers(t *testing.T, fetcher TranscriptFetcher) {
+	t.Helper()
+	queue := make(chan Job, 100)
+	queueMu.Lock()
+	previous := jobQueue
+	jobQueue = queue
+	queueMu.Unlock()
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go worker(queue, fetcher)
+	}
+	t.Cleanup(func() {
+		// Swap the queue back under the lock, like closeJobQueue, so jobs
+		// still being enqueued in the background never send on it once closed
+		queueMu.Lock()
+		jobQueue = previous
+		queueMu.Unlock()
+		close(queue)
+		wg.Wait()
+	})
+}
+
+func TestQueueDepthRejectsWithRetryAfter(t *testing.T) {
+	previousQueue, previousDepth := jobQueue, queueRejectDepth
+	t.Cleanup(func() { jobQueue, queueRejectDepth = previousQueue, previousDepth })
+
+	// No workers, so queued jobs stay put
+	jobQueue = make(chan Job, 10)
+	queueRejectDepth = 2
+	for i := 0; i < queueRejectDepth; i++ {
+		jobQueue <- Job{VideoID: "queued"}
+	}
+
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=dQw4w9WgXcQ", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if !strings.Contains(rec.Body.String(), "Server is busy") {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+func TestEnqueueTimeoutRejectsWith503(t *testing.T) {
+	previousQueue, previousDepth, previousTimeout := jobQueue, queueRejectDepth, enqueueTimeout
+	t.Cleanup(func() { jobQueue, queueRejectDepth, enqueueTimeout = previousQueue, previousDepth, previousTimeout })
+
+	// A full queue with no workers, under the depth limit so only the
+	// timeout can turn the job away
+	jobQueue = make(chan Job, 2)
+	queueRejectDepth = 100
+	enqueueTimeout = 20 * time.Millisecond
+	for i := 0; i < cap(jobQueue); i++ {
+		jobQueue <- Job{VideoID: "queued"}
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=enqueue0001&no_cache=true", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed < enqueueTimeout || elapsed > time.Second {
+		t.Errorf("rejected after %v, want about %v", elapsed, enqueueTimeout)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if !strings.Contains(rec.Body.String(), "overloaded") {
+		t.Errorf("body = %s", rec.Body)
+	}
+	if err := enqueueJob(Job{Ctx: context.Background(), VideoID: "enqueue0002"}); !errors.Is(err, errQueueFull) {
+		t.Errorf("enqueueJob = %v, want errQueueFull", err)
+	}
+
+	// A caller that gives up first isn't kept waiting for the timeout
+	enqueueTimeout = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := enqueueJob(Job{Ctx: ctx, VideoID: "enqueue0003"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("enqueueJob = %v, want context.Canceled", err)
+	}
+}
+
+func TestBatchStaysUnderQueueDepth(t *testing.T) {
+	previousDepth := queueRejectDepth
+	t.Cleanup(func() { queueRejectDepth = previousDepth })
+	// A batch keeps at most maxWorkers jobs in flight, so it never reaches
+	// this on its own
+	queueRejectDepth = maxWorkers + 1
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		time.Sleep(time.Millisecond) // Slow enough for unthrottled jobs to pile up
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}))
+
+	var req BatchRequest
+	for i := 0; i < maxBatchSize; i++ {
+		req.VideoIDs = append(req.VideoIDs, fmt.Sprintf("batch%06d", i))
+	}
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	batchHandler(rec, httptest.NewRequest("POST", "/transcript/batch", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var results []VideoResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != maxBatchSize {
+		t.Fatalf("got %d results, want %d", len(results), maxBatchSize)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("%s: %s", result.VideoID, result.Error)
+		}
+	}
+}
+
+func TestRateLimiterSharedAcrossWorkers(t *testing.T) {
+	withoutFallbacks(t)
+	const burst, interval, videos = 3, 50 * time.Millisecond, 7
+	previous := rateLimiter
+	rateLimiter = rate.NewLimiter(rate.Every(interval), burst)
+	t.Cleanup(func() { rateLimiter = previous })
+
+	var mu sync.Mutex
+	var fetchedAt []time.Duration
+	var running, mostRunning int
+	start := time.Now()
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		mu.Lock()
+		fetchedAt = append(fetchedAt, time.Since(start))
+		running++
+		mostRunning = max(mostRunning, running)
+		mu.Unlock()
+		time.Sleep(interval) // Long enough for the burst to overlap
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}))
+
+	var jobs sync.WaitGroup
+	for i := 0; i < videos; i++ {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			if response := runJob(Job{VideoID: fmt.Sprintf("bucket%05d", i), Languages: []string{"en"}, Options: defaultScanOptions()}); response.Error != "" {
+				t.Error(response.Error)
+			}
+		}()
+	}
+	jobs.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fetchedAt) != videos {
+		t.Fatalf("%d fetches, want %d", len(fetchedAt), videos)
+	}
+	slices.Sort(fetchedAt)
+	// The burst goes straight through, then one fetch per interval
+	for i, at := range fetchedAt {
+		if i < burst {
+			if at >= interval/2 {
+				t.Errorf("fetch %d waited %v, the burst shouldn't wait", i, at)
+			}
+		} else if want := time.Duration(i-burst+1)*interval - interval/5; at < want {
+			t.Errorf("fetch %d after %v, want at least %v", i, at, want)
+		}
+	}
+	if mostRunning < burst {
+		t.Errorf("at most %d fetches ran at once, want the burst of %d in parallel", mostRunning, burst)
+	}
+}
+
+// withoutFallbacks stops jobs from trying fallbackLanguages for the rest of
+// the test
+func withoutFallbacks(t *testing.T) {
+	previous := fallbackLanguages
+	fallbackLanguages = nil
+	t.Cleanup(func() { fallbackLanguages = previous })
+}
+
+func TestWorkerHandlesMalformedTranscripts(t *testing.T) {
+	withoutFallbacks(t)
+	tests := []struct {
+		name    string
+		fetcher fetcherFunc
+		want    error
+	}{
+		{"panic", func(string, []string) ([]yt_transcript_models.Transcript, error) {
+			panic("index out of range")
+		}, errTranscriptPanic},
+		{"nil slice without error", func(string, []string) ([]yt_transcript_models.Transcript, error) {
+			return nil, nil
+		}, errEmptyTranscript},
+		{"transcript without lines", func(string, []string) ([]yt_transcript_models.Transcript, error) {
+			return []yt_transcript_models.Transcript{{LanguageCode: "en"}}, nil
+		}, errEmptyTranscript},
+		{"only blank and badly timed lines", func(string, []string) ([]yt_transcript_models.Transcript, error) {
+			return []yt_transcript_models.Transcript{{LanguageCode: "en", Lines: []yt_transcript_models.TranscriptLine{
+				{Text: "  ", Start: 0, Duration: 1},
+				{Text: "hello", Start: math.NaN(), Duration: 1},
+				{Text: "there", Start: -3, Duration: 1},
+			}}}, nil
+		}, errEmptyTranscript},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startTestWorkers(t, tt.fetcher)
+			response := runJob(Job{VideoID: fmt.Sprintf("malformed%02d", i), Languages: []string{"en"}, Options: defaultScanOptions()})
+			if !errors.Is(response.Err, tt.want) {
+				t.Errorf("err = %v, want %v", response.Err, tt.want)
+			}
+			if response.Error == "" {
+				t.Error("missing error message")
+			}
+		})
+	}
+}
+
+func TestWorkerSkipsMalformedLines(t *testing.T) {
+	withoutFallbacks(t)
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{
+			{LanguageCode: "en"}, // Empty tracks next to a good one are ignored
+			{LanguageCode: "en", IsGenerated: true, Lines: []yt_transcript_models.TranscriptLine{
+				{Text: "", Start: 0, Duration: 1},
+				{Text: "what the fuck", Start: 1, Duration: math.Inf(1)},
+				{Text: "shit", Start: math.Inf(1), Duration: 1},
+			}},
+		}, nil
+	}))
+	response := runJob(Job{VideoID: "malformed99", Languages: []string{"en"}, Options: defaultScanOptions()})
+	if response.Error != "" {
+		t.Fatalf("error = %s", response.Error)
+	}
+	if !response.Profanity || response.ProfanityCount != 1 {
+		t.Errorf("profanity = %v, count = %d, want only the well-formed line counted", response.Profanity, response.ProfanityCount)
+	}
+}
+
+// benchmarkLines is an hour of one-second caption lines
+func benchmarkLines() yt_transcript_models.Transcript {
+	words := strings.Fields(benchmarkTranscript)
+	var texts []string
+	for len(words) > 0 {
+		n := min(8, len(words))
+		texts = append(texts, strings.Join(words[:n], " "))
+		words = words[n:]
+	}
+	return testTranscript("en", captionsAuto, texts...)
+}
+
+func BenchmarkScanTranscript(b *testing.B) {
+	transcript := benchmarkLines()
+	job := Job{VideoID: "benchmark01", Options: defaultScanOptions()}
+	dict := currentDictionary()
+	logger := slog.Default()
+	b.SetBytes(int64(len(benchmarkTranscript)))
+	for b.Loop() {
+		if _, err := scanTranscript(job, dict, transcript, logger); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScanTranscriptAllNormalization runs every opt-in normalization
+// step, the worst case for matchToken
+func BenchmarkScanTranscriptAllNormalization(b *testing.B) {
+	knobs := []*bool{&stripInnerPunctuation, &normalizeLeetspeak, &collapseElongation, &matchInflections, &splitJoinedWords}
+	for _, knob := range knobs {
+		previous := *knob
+		*knob = true
+		b.Cleanup(func() { *knob = previous })
+	}
+	transcript := benchmarkLines()
+	job := Job{VideoID: "benchmark02", Options: defaultScanOptions()}
+	dict := currentDictionary()
+	logger := slog.Default()
+	b.SetBytes(int64(len(benchmarkTranscript)))
+	for b.Loop() {
+		if _, err := scanTranscript(job, dict, transcript, logger); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTimestampsOnlyChangeReturnedText(t *testing.T) {
+	withoutFallbacks(t)
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "oh shit", "what the fuck", "hello there")}, nil
+	}))
+
+	var responses []TranscriptResponse
+	for _, query := range []string{"include_transcript=true", "include_transcript=true&timestamps=true"} {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=stamps00001&no_cache=true&"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", query, rec.Code, rec.Body)
+		}
+		var response TranscriptResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	plain, stamped := responses[0], responses[1]
+	if strings.Contains(plain.Transcript, "0.000000:") || !strings.Contains(stamped.Transcript, "1.000000: what the fuck") {
+		t.Errorf("transcripts = %q and %q", plain.Transcript, stamped.Transcript)
+	}
+	// The scan saw the same words either way
+	if stamped.WordsScanned != plain.WordsScanned || stamped.ProfanityCount != plain.ProfanityCount ||
+		!slices.Equal(stamped.ProfaneWords, plain.ProfaneWords) {
+		t.Errorf("with timestamps scanned %d words, %d hits %v; without %d words, %d hits %v",
+			stamped.WordsScanned, stamped.ProfanityCount, stamped.ProfaneWords,
+			plain.WordsScanned, plain.ProfanityCount, plain.ProfaneWords)
+	}
+
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=stamps00001&timestamps=true&include_offsets=true", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("timestamps with include_offsets: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCancelledRequestFreesWorker(t *testing.T) {
+	withoutFallbacks(t)
+	previousWorkers := maxWorkers
+	maxWorkers = 1 // So the follow-up job needs the same worker
+	t.Cleanup(func() { maxWorkers = previousWorkers })
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		started <- videoID
+		if videoID == "cancelled01" {
+			<-release
+		}
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=cancelled01", nil).WithContext(ctx))
+		close(done)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler kept waiting after the request was cancelled")
+	}
+	if rec.Code == http.StatusOK {
+		t.Errorf("status = %d for a cancelled request", rec.Code)
+	}
+
+	// The worker finishes the abandoned fetch, drops its result and moves on
+	close(release)
+	response := runJob(Job{VideoID: "cancelled02", Languages: []string{"en"}, Options: defaultScanOptions()})
+	if response.Error != "" {
+		t.Errorf("follow-up job failed: %s", response.Error)
+	}
+}
+
+// noRetrySleep makes retries immediate for the rest of the test
+func noRetrySleep(t *testing.T) {
+	previous := retrySleep
+	retrySleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	t.Cleanup(func() { retrySleep = previous })
+}
+
+// scriptedFetcher answers each language with its queue of results in turn,
+// repeating the last one, and records the languages asked for
+type scriptedFetcher struct {
+	mu      sync.Mutex
+	results map[string][]error // nil error means a transcript in that language
+	calls   []string
+}
+
+func (f *scriptedFetcher) GetTranscripts(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lang := langs[0]
+	f.calls = append(f.calls, lang)
+	queue, ok := f.results[lang]
+	if !ok {
+		return nil, errors.New("no transcript found for language " + lang)
+	}
+	err := queue[0]
+	if len(queue) > 1 {
+		f.results[lang] = queue[1:]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []yt_transcript_models.Transcript{testTranscript(lang, captionsManual, "hello there")}, nil
+}
+
+func TestFetchTranscriptRetriesNetworkErrors(t *testing.T) {
+	noRetrySleep(t)
+	fetcher := &scriptedFetcher{results: map[string][]error{
+		"en": {errors.New("connection reset"), errors.New("i/o timeout"), nil},
+	}}
+	transcripts, lang, attempts, err := fetchTranscript(context.Background(), fetcher, "fetch000001", []string{"en"}, captionsAny)
+	if err != nil || lang != "en" || len(transcripts) != 1 {
+		t.Fatalf("got %d transcripts in %q, err %v", len(transcripts), lang, err)
+	}
+	if want := (AttemptResult{Language: "en", Found: true, Attempts: 3}); len(attempts) != 1 || attempts[0] != want {
+		t.Errorf("attempts = %+v, want %+v", attempts, want)
+	}
+}
+
+func TestFetchTranscriptGivesUpAfterMaxAttempts(t *testing.T) {
+	noRetrySleep(t)
+	fetcher := &scriptedFetcher{results: map[string][]error{"en": {errors.New("network unreachable")}}}
+	_, _, attempts, err := fetchTranscript(context.Background(), fetcher, "fetch000002", []string{"en"}, captionsAny)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts[0].Attempts != maxFetchAttempts || attempts[0].Found || attempts[0].Error == "" {
+		t.Errorf("attempts = %+v", attempts)
+	}
+}
+
+func TestFetchTranscriptFallsBackToNextLanguage(t *testing.T) {
+	noRetrySleep(t)
+	fetcher := &scriptedFetcher{results: map[string][]error{"es": {nil}}}
+	transcripts, lang, attempts, err := fetchTranscript(context.Background(), fetcher, "fetch000003", []string{"en", "fr", "es", "de"}, captionsAny)
+	if err != nil || lang != "es" || transcripts[0].LanguageCode != "es" {
+		t.Fatalf("lang = %q, err = %v", lang, err)
+	}
+	// Missing captions aren't retried, and later languages aren't tried
+	if want := []string{"en", "fr", "es"}; !slices.Equal(fetcher.calls, want) {
+		t.Errorf("calls = %v, want %v", fetcher.calls, want)
+	}
+	if len(attempts) != 3 || attempts[0].Found || !attempts[2].Found {
+		t.Errorf("attempts = %+v", attempts)
+	}
+}
+
+func TestFetchTranscriptStopsWhenThrottled(t *testing.T) {
+	noRetrySleep(t)
+	fetcher := &scriptedFetcher{results: map[string][]error{"en": {errYouTubeThrottled}, "es": {nil}}}
+	_, _, _, err := fetchTranscript(context.Background(), fetcher, "fetch000004", []string{"en", "es"}, captionsAny)
+	if !errors.Is(err, errYouTubeThrottled) {
+		t.Errorf("err = %v, want errYouTubeThrottled", err)
+	}
+	if !slices.Equal(fetcher.calls, []string{"en"}) {
+		t.Errorf("calls = %v, want only en", fetcher.calls)
+	}
+}
+
+func TestFetchTranscriptCaptionKind(t *testing.T) {
+	noRetrySleep(t)
+	fetcher := fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript(langs[0], captionsAuto, "hello")}, nil
+	})
+	_, _, _, err := fetchTranscript(context.Background(), fetcher, "fetch000005", []string{"en", "es"}, captionsManual)
+	if !errors.Is(err, errCaptionKindMissing) {
+		t.Errorf("err = %v, want errCaptionKindMissing", err)
+	}
+	if _, _, _, err := fetchTranscript(context.Background(), fetcher, "fetch000005", []string{"en"}, captionsAuto); err != nil {
+		t.Errorf("auto captions: %v", err)
+	}
+}
+
+func TestClassifyFetchError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    error
+		status  int
+	}{
+		{"captions not found for this video", errNoCaptions, http.StatusNotFound},
+		{"playerCaptionsTracklistRenderer not found", errNoCaptions, http.StatusNotFound},
+		{"no transcript found for language en", errNoCaptions, http.StatusNotFound},
+		{"This video is private", errPrivateVideo, http.StatusForbidden},
+		{"Video unavailable", errVideoUnavailable, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		err := classifyFetchError(errors.New(tt.message))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("classifyFetchError(%q) = %v, want %v", tt.message, err, tt.want)
+		}
+		if status := errorStatusCode(err); status != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.message, status, tt.status)
+		}
+	}
+	// Sentinels pass through untouched
+	for _, err := range []error{errYouTubeThrottled, errCaptionKindMissing, context.DeadlineExceeded} {
+		if got := classifyFetchError(err); got != err {
+			t.Errorf("classifyFetchError(%v) = %v", err, got)
+		}
+	}
+	if err := classifyFetchError(errors.New("something odd")); errorStatusCode(err) != http.StatusInternalServerError {
+		t.Errorf("unknown error: status = %d", errorStatusCode(err))
+	}
+}
+
+func TestWorkerReportsClassifiedErrors(t *testing.T) {
+	withoutFallbacks(t)
+	noRetrySleep(t)
+	startTestWorkers(t, failingFetcher("This video is private"))
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=fetch000006", nil))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "is private") {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestErrorStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errShuttingDown, http.StatusServiceUnavailable},
+		{errYouTubeThrottled, http.StatusServiceUnavailable},
+		{errNoDictionary, http.StatusServiceUnavailable},
+		{errQueueFull, http.StatusServiceUnavailable},
+		{errServerBusy, http.StatusTooManyRequests},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errNoCaptions, http.StatusNotFound},
+		{errCaptionKindMissing, http.StatusNotFound},
+		{errEmptyTranscript, http.StatusNotFound},
+		{errPrivateVideo, http.StatusForbidden},
+		{errVideoUnavailable, http.StatusForbidden},
+		{errTranscriptPanic, http.StatusInternalServerError},
+		{errors.New("something odd"), http.StatusInternalServerError},
+		{nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatusCode(tt.err); got != tt.want {
+			t.Errorf("errorStatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+		// Wrapping keeps the status, which is why the mapping uses errors.Is
+		if tt.err == nil {
+			continue
+		}
+		if got := errorStatusCode(fmt.Errorf("video abc: %w", tt.err)); got != tt.want {
+			t.Errorf("errorStatusCode(wrapped %v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestThrottledCheckReturns503WithRetryAfter(t *testing.T) {
+	withoutFallbacks(t)
+	noRetrySleep(t)
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return nil, fmt.Errorf("%w: status 429", errYouTubeThrottled)
+	}))
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=status00001&no_cache=true", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503: %s", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("Retry-After"), strconv.Itoa(int(throttleRetryAfter/time.Second)); got != want {
+		t.Errorf("Retry-After = %q, want %q", got, want)
+	}
+}
+
+func TestShuttingDownReturns503(t *testing.T) {
+	previousQueue := jobQueue
+	queueMu.Lock()
+	jobQueue = make(chan Job, 10)
+	queueClosed = true
+	queueMu.Unlock()
+	t.Cleanup(func() {
+		queueMu.Lock()
+		jobQueue, queueClosed = previousQueue, false
+		queueMu.Unlock()
+	})
+
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=status00002&no_cache=true", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "shutting down") {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestParseFallbackLanguages(t *testing.T) {
+	for raw, want := range map[string][]string{
+		"en,es, fr ,": {"en", "es", "fr"},
+		"none":        nil,
+		"de":          {"de"},
+	} {
+		if got := parseFallbackLanguages(raw); !slices.Equal(got, want) {
+			t.Errorf("parseFallbackLanguages(%q) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestWithFallbackLanguages(t *testing.T) {
+	previous := fallbackLanguages
+	fallbackLanguages = []string{"en", "es", "fr"}
+	t.Cleanup(func() { fallbackLanguages = previous })
+
+	// Requested languages come first, fallbacks follow without repeats
+	if got, want := withFallbackLanguages([]string{"fr", "de"}), []string{"fr", "de", "en", "es"}; !slices.Equal(got, want) {
+		t.Errorf("withFallbackLanguages = %v, want %v", got, want)
+	}
+	fallbackLanguages = nil
+	if got := withFallbackLanguages([]string{"de"}); !slices.Equal(got, []string{"de"}) {
+		t.Errorf("without fallbacks = %v", got)
+	}
+}
+
+func TestFallbackLanguagesTriedAfterRequested(t *testing.T) {
+	noRetrySleep(t)
+	previous := fallbackLanguages
+	fallbackLanguages = []string{"es", "de"}
+	t.Cleanup(func() { fallbackLanguages = previous })
+	fetcher := &scriptedFetcher{results: map[string][]error{"de": {nil}}}
+	startTestWorkers(t, fetcher)
+
+	// Not English, so the old en-only fallback would never have kicked in
+	response := runJob(Job{VideoID: "fallback001", Languages: []string{"fr"}, Options: defaultScanOptions()})
+	if response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	if response.Language != "de" {
+		t.Errorf("language = %q, want the de fallback", response.Language)
+	}
+	if want := []string{"fr", "es", "de"}; !slices.Equal(fetcher.calls, want) {
+		t.Errorf("calls = %v, want %v", fetcher.calls, want)
+	}
+}
+
+func TestOutboundRequestLimit(t *testing.T) {
+	withoutFallbacks(t)
+	previous := outboundRequests
+	outboundRequests = semaphore.NewWeighted(2)
+	t.Cleanup(func() { outboundRequests = previous })
+
+	var inFlight, peak atomic.Int32
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		now := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := peak.Load()
+			if now <= seen || peak.CompareAndSwap(seen, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3*maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runJob(Job{VideoID: fmt.Sprintf("outbound%03d", i), Languages: []string{"en"}, Options: defaultScanOptions()})
+		}()
+	}
+	wg.Wait()
+	// More workers than slots, so the semaphore is what held them back
+	if got := peak.Load(); got != 2 {
+		t.Errorf("peak outbound requests = %d with %d workers, want 2", got, maxWorkers)
+	}
+}
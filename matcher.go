@@ -0,0 +1,632 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stripInnerPunctuation also removes punctuation inside tokens ("f.u.c.k",
+// "sh-it") before matching. Off by default since it merges contractions
+// ("we'll" -> "well").
+var stripInnerPunctuation = false
+
+// splitJoinedWords also checks the parts of tokens joined with hyphens or
+// slashes ("fuck-you", "bull/shit"). Off by default. Only a part that is
+// itself a dictionary entry counts, so ordinary compounds ("self-destruct")
+// stay clean, but the likes of "kick-ass" are flagged.
+var splitJoinedWords = false
+
+// normalizeLeetspeak also tries tokens with common character substitutions
+// undone ("sh1t", "a$$"). Off by default since it can turn numbers and
+// prices into words.
+var normalizeLeetspeak = false
+
+// collapseElongation also tries tokens with stretched letters shortened
+// ("fuuuuck", "shiiiit"). Off by default. Only runs of three or more of the
+// same letter are touched, so double letters ("bookkeeper") never change.
+var collapseElongation = false
+
+// matchInflections also tries tokens with common English suffixes removed
+// ("fucking", "fucked", "bitches"), see inflectionStems. Off by default.
+var matchInflections = false
+
+// inflectionSuffixes are stripped by inflectionStems, longest first
+var inflectionSuffixes = []string{"ing", "ers", "ed", "er", "es", "s"}
+
+// minStemLength keeps suffix stripping from reducing words to fragments
+// short enough to collide with unrelated dictionary entries
+const minStemLength = 3
+
+// leetspeakTable maps substituted characters back to the letters they stand
+// in for. "1" is read as "i", the more common of its two meanings.
+var leetspeakTable = strings.NewReplacer(
+	"1", "i",
+	"3", "e",
+	"4", "a",
+	"0", "o",
+	"@", "a",
+	"$", "s",
+)
+
+// leetspeakChars are the characters leetspeakTable rewrites
+const leetspeakChars = "1340@$"
+
+// MatchMode selects how tokens are compared against the dictionary
+type MatchMode string
+
+const (
+	// MatchWord only flags tokens that are themselves dictionary entries
+	MatchWord MatchMode = "word"
+	// MatchSubstring also flags tokens that merely contain a dictionary
+	// entry ("dumbass"). This is opt-in because it runs straight into the
+	// Scunthorpe problem: innocent words like "assessment" or "classic"
+	// contain profanity too.
+	MatchSubstring MatchMode = "substring"
+)
+
+// minSubstringLength is the shortest dictionary entry substring mode will
+// look for inside a token, to keep two-letter entries from matching
+// everywhere
+const minSubstringLength = 3
+
+// defaultMatchMode applies when a request doesn't pick one (MATCH_MODE)
+var defaultMatchMode = MatchWord
+
+// MatchOptions controls how the scanner matches tokens
+type MatchOptions struct {
+	Mode  MatchMode
+	Allow []string // Per-request additions to the dictionary's allowlist
+	// Only ignore case and surrounding punctuation, skipping the optional
+	// normalization steps, see compare_normalization
+	Exact bool
+}
+
+// parseAllowParam splits a comma separated ?allow= list into lowercase words
+func parseAllowParam(raw string) []string {
+	var words []string
+	for _, word := range strings.Split(raw, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// isAllowed reports whether a normalized word is on the dictionary's or the
+// request's allowlist. Allowed words always win over dictionary entries.
+func isAllowed(dict *dictionary, options MatchOptions, word string) bool {
+	if _, ok := dict.allowed[word]; ok {
+		return true
+	}
+	for _, allowed := range options.Allow {
+		if allowed == word {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMatchMode validates a match mode name
+func parseMatchMode(raw string) (MatchMode, error) {
+	switch mode := MatchMode(strings.ToLower(raw)); mode {
+	case MatchWord, MatchSubstring:
+		return mode, nil
+	}
+	return "", fmt.Errorf("match mode must be %q or %q", MatchWord, MatchSubstring)
+}
+
+// traceFunc receives each step matchToken takes. It is nil on the hot path
+// and only set by the explain endpoint.
+type traceFunc func(step, value string)
+
+func (t traceFunc) step(name, value string) {
+	if t != nil {
+		t(name, value)
+	}
+}
+
+// profanityMatches is what the scanner found in a piece of text
+type profanityMatches struct {
+	counts    map[string]int // Occurrences per dictionary entry
+	words     []string       // Surface form of each distinct match, in order of first appearance
+	entries   []string       // Dictionary entry for each of words
+	hits      int            // Total profane occurrences
+	wordCount int            // Total tokens scanned
+	severity  int            // Highest severity among the matched entries
+	// Distinct categories of the matched entries, in order of first appearance
+	categories []string
+	text       string        // The scanned text, see offsets
+	tokens     []string      // The scanned tokens, see contexts
+	positions  []tokenOffset // Where each token is in text
+	spans      []tokenSpan   // Tokens covered by each hit, in order
+}
+
+// tokenSpan is the range of tokens [start, end) one hit covers and the entry
+// it matched
+type tokenSpan struct {
+	start, end int
+	entry      string
+}
+
+// Words of context returned around each hit. CONTEXT_WINDOW overrides the
+// default and context_window overrides it per request, up to
+// maxContextWindow; 0 leaves contexts out.
+var contextWindowDefault = 3
+
+const maxContextWindow = 20
+
+// MatchContext is one hit with the words around it, for judging intent
+type MatchContext struct {
+	Word   string `json:"word"`   // As it appeared in the transcript
+	Before string `json:"before"` // Up to the context window of words before
+	After  string `json:"after"`  // Up to the context window of words after
+}
+
+// contexts returns every hit with up to window tokens on either side, taken
+// from the tokens that were scanned
+func (m profanityMatches) contexts(window int) []MatchContext {
+	contexts := make([]MatchContext, len(m.spans))
+	for i, span := range m.spans {
+		contexts[i] = MatchContext{
+			Word:   spanSurfaceForm(m.tokens[span.start:span.end]),
+			Before: joinTokens(m.tokens[max(0, span.start-window):span.start]),
+			After:  joinTokens(m.tokens[span.end:min(len(m.tokens), span.end+window)]),
+		}
+	}
+	return contexts
+}
+
+// MatchOffset locates one hit in the scanned text. Offsets count Unicode
+// code points from the start of the transcript, end exclusive, and leave out
+// punctuation around the hit.
+type MatchOffset struct {
+	Word  string `json:"word"`  // The text between start and end
+	Entry string `json:"entry"` // The dictionary entry it matched
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// offsets returns where every hit is in the scanned text
+func (m profanityMatches) offsets() []MatchOffset {
+	offsets := make([]MatchOffset, len(m.spans))
+	// Hits are in text order, so byte offsets convert to code points in one
+	// pass over the text
+	bytePos, runePos := 0, 0
+	toRunes := func(target int) int {
+		runePos += utf8.RuneCountInString(m.text[bytePos:target])
+		bytePos = target
+		return runePos
+	}
+	for i, span := range m.spans {
+		first, last := m.tokens[span.start], m.tokens[span.end-1]
+		start := m.positions[span.start].start
+		end := m.positions[span.end-1].end
+		if trimmed := trimPunctuation(first); trimmed != "" {
+			start += strings.Index(first, trimmed)
+		}
+		if trimmed := trimPunctuation(last); trimmed != "" {
+			end -= len(last) - strings.Index(last, trimmed) - len(trimmed)
+		}
+		offsets[i] = MatchOffset{
+			Word:  m.text[start:end],
+			Entry: span.entry,
+			Start: toRunes(start),
+			End:   toRunes(end),
+		}
+	}
+	return offsets
+}
+
+// density is the share of scanned words that were profane, rounded to four
+// decimals
+func (m profanityMatches) density() float64 {
+	if m.wordCount == 0 {
+		return 0
+	}
+	return math.Round(float64(m.hits)/float64(m.wordCount)*10000) / 10000
+}
+
+// breakdown lists every distinct match with its count and classification, in
+// order of first appearance
+func (m profanityMatches) breakdown(dict *dictionary) []WordCount {
+	counts := make([]WordCount, len(m.entries))
+	for i, entry := range m.entries {
+		info := dict.words[entry]
+		counts[i] = WordCount{
+			Word:     m.words[i],
+			Entry:    entry,
+			Count:    m.counts[entry],
+			Category: info.Category,
+			Severity: info.Severity,
+		}
+	}
+	return counts
+}
+
+// findProfanity scans text and returns every dictionary entry it contains.
+// A word that appears several times is listed once in words, using the form
+// it had the first time it was seen.
+func findProfanity(dict *dictionary, text string, options MatchOptions) profanityMatches {
+	matches := profanityMatches{counts: make(map[string]int), words: []string{}, categories: []string{}}
+	tokens, positions := tokenizeOffsets(text)
+	matches.wordCount = len(tokens)
+	matches.text = text
+	matches.tokens = tokens
+	matches.positions = positions
+	matchTokens(dict, tokens, options, func(entry string, start int, span []string) {
+		if matches.counts[entry] == 0 {
+			matches.words = append(matches.words, spanSurfaceForm(span))
+			matches.entries = append(matches.entries, entry)
+			info := dict.words[entry]
+			matches.severity = max(matches.severity, info.Severity)
+			if !slices.Contains(matches.categories, info.Category) {
+				matches.categories = append(matches.categories, info.Category)
+			}
+		}
+		matches.counts[entry]++
+		matches.hits++
+		matches.spans = append(matches.spans, tokenSpan{start, start + len(span), entry})
+	})
+	return matches
+}
+
+// matchTokens walks the tokens and calls found for every dictionary hit with
+// the entry it matched, the index of its first token and the tokens it
+// covers. Multi-word entries are tried
+// first, longest first, and tokens that are part of a matched phrase aren't
+// matched again on their own. Dictionaries without phrases skip that step.
+func matchTokens(dict *dictionary, tokens []string, options MatchOptions, found func(entry string, start int, span []string)) {
+	for i := 0; i < len(tokens); i++ {
+		if n, phrase := matchPhrase(dict, tokens[i:], options); n > 0 {
+			found(phrase, i, tokens[i:i+n])
+			i += n - 1
+			continue
+		}
+		if entry, ok := matchToken(dict, tokens[i], options, nil); ok {
+			found(entry, i, tokens[i:i+1])
+		}
+	}
+}
+
+// matchPhrase returns how many of the leading tokens make up the longest
+// multi-word dictionary entry they start with, and that entry
+func matchPhrase(dict *dictionary, tokens []string, options MatchOptions) (int, string) {
+	n := min(dict.maxPhrase, len(tokens))
+	if n < 2 {
+		return 0, ""
+	}
+	parts := make([]string, n)
+	for i, token := range tokens[:n] {
+		parts[i] = strings.ToLower(trimPunctuation(token))
+	}
+	for ; n >= 2; n-- {
+		phrase := joinTokens(parts[:n])
+		if _, ok := dict.words[phrase]; ok && !isAllowed(dict, options, phrase) {
+			return n, phrase
+		}
+	}
+	return 0, ""
+}
+
+// phraseLength is the number of tokens in a dictionary entry
+func phraseLength(entry string) int {
+	return len(tokenize(entry))
+}
+
+// maxPhraseLength is the number of words in the longest entry of a list
+func maxPhraseLength(words wordList) int {
+	longest := 0
+	for word := range words {
+		longest = max(longest, phraseLength(word))
+	}
+	return longest
+}
+
+// tokenize splits text into candidate words. Text is split on whitespace,
+// except for scripts written without spaces (Chinese, Japanese) where every
+// character becomes a token of its own; multi-character entries in those
+// scripts are then found by phrase matching. A caption line that is one long
+// run of CJK text would otherwise be a single token that never matches.
+func tokenize(text string) []string {
+	tokens, _ := tokenizeOffsets(text)
+	return tokens
+}
+
+// tokenOffset is the byte range [start, end) of a token in the text it was
+// split from
+type tokenOffset struct {
+	start, end int
+}
+
+// tokenizeOffsets is tokenize that also returns where each token is, so hits
+// can be located in the original text
+func tokenizeOffsets(text string) ([]string, []tokenOffset) {
+	tokens := []string{}
+	offsets := []tokenOffset{}
+	start := -1 // Start of the token being read, -1 between tokens
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, text[start:end])
+			offsets = append(offsets, tokenOffset{start, end})
+			start = -1
+		}
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case unicode.IsSpace(r):
+			flush(i)
+		case isUnspacedRune(r):
+			flush(i)
+			tokens = append(tokens, text[i:i+size])
+			offsets = append(offsets, tokenOffset{i, i + size})
+		case start < 0:
+			start = i
+		}
+		i += size
+	}
+	flush(len(text))
+	return tokens, offsets
+}
+
+// isUnspacedRune reports whether r belongs to a script that doesn't put
+// spaces between words
+func isUnspacedRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// joinTokens reverses tokenize: tokens are joined with spaces, except
+// between characters of unspaced scripts
+func joinTokens(tokens []string) string {
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 {
+			last, _ := utf8.DecodeLastRuneInString(tokens[i-1])
+			first, _ := utf8.DecodeRuneInString(token)
+			if !isUnspacedRune(last) || !isUnspacedRune(first) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// matchToken normalizes a single token and looks it up in the dictionary,
+// returning the dictionary entry it matched. The token is tried as-is first
+// so entries that contain symbols ("@$$") still match, then with the
+// surrounding punctuation removed. In substring mode the normalized token is
+// finally searched for any dictionary entry it contains. Allowlisted words
+// are never reported, even when the dictionary has them.
+func matchToken(dict *dictionary, token string, options MatchOptions, trace traceFunc) (string, bool) {
+	word := strings.ToLower(token)
+	trace.step("lowercase", word)
+	if lookupWord(dict, word, trace) {
+		return checkAllowlist(dict, options, word, trace)
+	}
+
+	if trimmed := trimPunctuation(word); trimmed != word {
+		word = trimmed
+		trace.step("trim_punctuation", word)
+		if lookupWord(dict, word, trace) {
+			return checkAllowlist(dict, options, word, trace)
+		}
+	}
+
+	joined := word // Before stripInnerPunctuation removes the joins
+	normalize := !options.Exact
+	if normalize && stripInnerPunctuation {
+		if stripped := removePunctuation(word); stripped != word {
+			word = stripped
+			trace.step("strip_inner_punctuation", word)
+			if lookupWord(dict, word, trace) {
+				return checkAllowlist(dict, options, word, trace)
+			}
+		}
+	}
+
+	if normalize && normalizeLeetspeak {
+		if normalized := trimPunctuation(normalizeToken(strings.ToLower(token))); normalized != word {
+			word = normalized
+			trace.step("leetspeak", word)
+			if lookupWord(dict, word, trace) {
+				return checkAllowlist(dict, options, word, trace)
+			}
+		}
+	}
+
+	if normalize && collapseElongation {
+		// Try keeping two letters of each run first ("shiiiit" -> "shiit"
+		// doesn't match but "cooool" -> "cool" does), then one
+		for _, keep := range []int{2, 1} {
+			if collapsed := collapseRuns(word, keep); collapsed != word {
+				trace.step("elongation", collapsed)
+				if lookupWord(dict, collapsed, trace) {
+					return checkAllowlist(dict, options, collapsed, trace)
+				}
+			}
+		}
+	}
+
+	if normalize && matchInflections {
+		for _, stem := range inflectionStems(word) {
+			trace.step("inflection", stem)
+			if lookupWord(dict, stem, trace) {
+				return checkAllowlist(dict, options, stem, trace)
+			}
+		}
+	}
+
+	if normalize && splitJoinedWords && !isAllowed(dict, options, joined) {
+		if parts := splitJoined(joined); len(parts) > 1 {
+			for _, part := range parts {
+				trace.step("split_joined", part)
+				if lookupWord(dict, part, trace) {
+					return checkAllowlist(dict, options, part, trace)
+				}
+			}
+		}
+	}
+
+	if options.Mode == MatchSubstring {
+		if isAllowed(dict, options, word) {
+			// An allowlisted word like "scunthorpe" must not match on its parts
+			trace.step("allowlist", "hit")
+			return word, false
+		}
+		if entry, ok := findSubstring(dict, word); ok {
+			trace.step("substring", entry)
+			return checkAllowlist(dict, options, entry, trace)
+		}
+		trace.step("substring", "miss")
+	}
+
+	return word, false
+}
+
+// normalizeToken undoes common leetspeak substitutions, see leetspeakTable.
+// Tokens without any substituted characters are returned untouched without
+// allocating.
+func normalizeToken(token string) string {
+	if !strings.ContainsAny(token, leetspeakChars) {
+		return token
+	}
+	return leetspeakTable.Replace(token)
+}
+
+// collapseRuns shortens every run of three or more identical letters to keep
+// letters, leaving shorter runs alone
+func collapseRuns(word string, keep int) string {
+	runes := []rune(word)
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		run := j - i
+		if run >= 3 && unicode.IsLetter(runes[i]) {
+			run = keep
+		}
+		for k := 0; k < run; k++ {
+			out = append(out, runes[i])
+		}
+		i = j
+	}
+	return string(out)
+}
+
+// inflectionStems returns the candidate stems of word, one per matching
+// suffix, with a doubled final consonant undone as well ("shitting" ->
+// "shitt" -> "shit"). Stems shorter than minStemLength are skipped, and since
+// only stems found in the dictionary count as hits, innocuous words like
+// "class" or "passing" don't match on a fragment.
+func inflectionStems(word string) []string {
+	var stems []string
+	for _, suffix := range inflectionSuffixes {
+		stem, ok := strings.CutSuffix(word, suffix)
+		if !ok || utf8.RuneCountInString(stem) < minStemLength {
+			continue
+		}
+		stems = append(stems, stem)
+		if n := len(stem); suffix != "s" && stem[n-1] < utf8.RuneSelf && stem[n-1] == stem[n-2] && utf8.RuneCountInString(stem) > minStemLength {
+			stems = append(stems, stem[:n-1])
+		}
+	}
+	return stems
+}
+
+// checkAllowlist turns a dictionary hit into a miss when the word is allowed
+func checkAllowlist(dict *dictionary, options MatchOptions, word string, trace traceFunc) (string, bool) {
+	if isAllowed(dict, options, word) {
+		trace.step("allowlist", "hit")
+		return word, false
+	}
+	return word, true
+}
+
+// findSubstring returns the longest dictionary entry contained in word,
+// preferring the leftmost one on ties
+func findSubstring(dict *dictionary, word string) (string, bool) {
+	runes := []rune(word)
+	best := ""
+	for start := 0; start < len(runes); start++ {
+		for end := len(runes); end-start >= minSubstringLength && end-start > len([]rune(best)); end-- {
+			candidate := string(runes[start:end])
+			if _, exists := dict.words[candidate]; exists {
+				best = candidate
+				break
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// splitJoined splits a lowercase token on hyphens and slashes, trimming
+// punctuation off each part
+func splitJoined(word string) []string {
+	var parts []string
+	for _, part := range strings.FieldsFunc(word, func(r rune) bool { return r == '-' || r == '/' }) {
+		if part = trimPunctuation(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// lookupWord checks a normalized word against the dictionary
+func lookupWord(dict *dictionary, word string, trace traceFunc) bool {
+	if word == "" {
+		return false
+	}
+	_, exists := dict.words[word]
+	if exists {
+		trace.step("exact", "hit")
+	} else {
+		trace.step("exact", "miss")
+	}
+	return exists
+}
+
+// isWordRune reports whether r can be part of a word rather than punctuation
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// trimPunctuation removes leading and trailing punctuation, including
+// Unicode quotes and dashes ("—bitch—", "damn.", "“shit”")
+func trimPunctuation(token string) string {
+	return strings.TrimFunc(token, func(r rune) bool { return !isWordRune(r) })
+}
+
+// removePunctuation drops every non-word rune from the token
+func removePunctuation(token string) string {
+	return strings.Map(func(r rune) rune {
+		if isWordRune(r) {
+			return r
+		}
+		return -1
+	}, token)
+}
+
+// surfaceForm is how a matched token is reported back: as it appeared in the
+// transcript, minus surrounding punctuation
+func surfaceForm(token string) string {
+	if trimmed := trimPunctuation(token); trimmed != "" {
+		return trimmed
+	}
+	return token
+}
+
+// spanSurfaceForm is surfaceForm for the tokens of a phrase match
+func spanSurfaceForm(span []string) string {
+	forms := make([]string, len(span))
+	for i, token := range span {
+		forms[i] = surfaceForm(token)
+	}
+	return joinTokens(forms)
+}
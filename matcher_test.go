@@ -0,0 +1,687 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// testDictionary builds a dictionary from word/info pairs
+func testDictionary(words wordList) *dictionary {
+	return newDictionary(words, "test")
+}
+
+func TestBreakdownCarriesSeverity(t *testing.T) {
+	dict := testDictionary(wordList{
+		"damn":   {Category: "mild", Severity: 1},
+		"fuck":   {Category: "vulgar", Severity: 3},
+		"faggot": {Category: "slur", Severity: 5},
+	})
+	matches := findProfanity(dict, "Damn, that FUCKING... no, fuck you faggot. damn", MatchOptions{Mode: MatchWord})
+	want := []WordCount{
+		{Word: "Damn", Entry: "damn", Count: 2, Category: "mild", Severity: 1},
+		{Word: "fuck", Entry: "fuck", Count: 1, Category: "vulgar", Severity: 3},
+		{Word: "faggot", Entry: "faggot", Count: 1, Category: "slur", Severity: 5},
+	}
+	got := matches.breakdown(dict)
+	if len(got) != len(want) {
+		t.Fatalf("breakdown = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("word %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if matches.severity != 5 {
+		t.Errorf("max severity = %d, want 5", matches.severity)
+	}
+}
+
+func TestWordCountsInResponseCarrySeverity(t *testing.T) {
+	withoutFallbacks(t)
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "damn it", "what the fuck")}, nil
+	}))
+	response := runJob(Job{VideoID: "severity001", Languages: []string{"en"}, Options: defaultScanOptions()})
+	if response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	dict := currentDictionary()
+	if len(response.WordCounts) == 0 {
+		t.Fatal("no word counts")
+	}
+	for _, wordCount := range response.WordCounts {
+		if want := dict.words[wordCount.Entry].Severity; wordCount.Severity != want {
+			t.Errorf("%s severity = %d, want %d from the dictionary", wordCount.Entry, wordCount.Severity, want)
+		}
+	}
+}
+
+// benchmarkParagraph is mostly clean speech with the odd swear
+const benchmarkParagraph = "so I was walking down the street and this guy just comes up to me " +
+	"and says what the fuck are you doing here, and I'm like damn man I live here, " +
+	"it's my street, you know what I mean, anyway we had a laugh about it. "
+
+// benchmarkTranscript is roughly an hour of speech
+var benchmarkTranscript = strings.Repeat(benchmarkParagraph, 400)
+
+// categorizedDictionary splits the embedded word list round-robin into n
+// categories with their own severities, as if n lists had been loaded
+func categorizedDictionary(tb testing.TB, n int) (*dictionary, []*dictionary) {
+	tb.Helper()
+	words, err := parseProfanityWords(strings.NewReader(embeddedProfanityWords))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	entries := slices.Sorted(maps.Keys(words))
+	merged := make(wordList, len(words))
+	lists := make([]wordList, n)
+	for i, entry := range entries {
+		info := wordInfo{Category: fmt.Sprintf("list%d", i%n), Severity: i%n + 1}
+		merged[entry] = info
+		if lists[i%n] == nil {
+			lists[i%n] = make(wordList)
+		}
+		lists[i%n][entry] = info
+	}
+	perList := make([]*dictionary, n)
+	for i, list := range lists {
+		perList[i] = testDictionary(list)
+	}
+	return testDictionary(merged), perList
+}
+
+// BenchmarkFindProfanitySinglePass scans once with every list merged into one
+// dictionary, which is how scans run
+func BenchmarkFindProfanitySinglePass(b *testing.B) {
+	merged, _ := categorizedDictionary(b, 4)
+	b.SetBytes(int64(len(benchmarkTranscript)))
+	for b.Loop() {
+		matches := findProfanity(merged, benchmarkTranscript, MatchOptions{Mode: MatchWord})
+		_ = matches.breakdown(merged)
+	}
+}
+
+// BenchmarkFindProfanityMultiPass is the naive alternative, one scan per list
+// with the results combined afterwards
+func BenchmarkFindProfanityMultiPass(b *testing.B) {
+	_, perList := categorizedDictionary(b, 4)
+	b.SetBytes(int64(len(benchmarkTranscript)))
+	for b.Loop() {
+		var counts []WordCount
+		for _, dict := range perList {
+			matches := findProfanity(dict, benchmarkTranscript, MatchOptions{Mode: MatchWord})
+			counts = append(counts, matches.breakdown(dict)...)
+		}
+		_ = counts
+	}
+}
+
+// TestSinglePassAttributesEveryList checks the merged scan finds exactly what
+// the per-list scans find, with the same classification
+func TestSinglePassAttributesEveryList(t *testing.T) {
+	merged, perList := categorizedDictionary(t, 4)
+	want := make(map[string]WordCount)
+	for _, dict := range perList {
+		for _, wordCount := range findProfanity(dict, benchmarkParagraph, MatchOptions{Mode: MatchWord}).breakdown(dict) {
+			want[wordCount.Entry] = wordCount
+		}
+	}
+	got := findProfanity(merged, benchmarkParagraph, MatchOptions{Mode: MatchWord}).breakdown(merged)
+	if len(got) != len(want) || len(got) == 0 {
+		t.Fatalf("single pass found %d entries, per-list scans %d", len(got), len(want))
+	}
+	for _, wordCount := range got {
+		if wordCount != want[wordCount.Entry] {
+			t.Errorf("%s = %+v, per-list scan gave %+v", wordCount.Entry, wordCount, want[wordCount.Entry])
+		}
+	}
+}
+
+func TestMatchTokenPunctuation(t *testing.T) {
+	dict := currentDictionary()
+	tests := []struct {
+		token string
+		entry string // Empty for no match
+	}{
+		{"damn.", "damn"},
+		{"shit,", "shit"},
+		{"fuck!", "fuck"},
+		{"(damn)", "damn"},
+		{"—bitch—", "bitch"},
+		{"“shit”", "shit"},
+		{"‘damn’", "damn"},
+		{"f*ck", "f*ck"},  // Entries with symbols match as written
+		{"f*ck!", "f*ck"}, // Only the surrounding punctuation is trimmed
+		{"d.a.m.n", ""},   // Inner punctuation stays unless stripped
+		{"...", ""},
+		{"hello,", ""},
+	}
+	for _, tt := range tests {
+		entry, ok := matchToken(dict, tt.token, MatchOptions{Mode: MatchWord}, nil)
+		if ok != (tt.entry != "") || (ok && entry != tt.entry) {
+			t.Errorf("matchToken(%q) = %q, %v, want %q", tt.token, entry, ok, tt.entry)
+		}
+	}
+}
+
+func TestMatchTokenStripInnerPunctuation(t *testing.T) {
+	previous := stripInnerPunctuation
+	stripInnerPunctuation = true
+	t.Cleanup(func() { stripInnerPunctuation = previous })
+
+	dict := currentDictionary()
+	for token, want := range map[string]string{
+		"d.a.m.n": "damn",
+		"da-mn!":  "damn",
+		"f*ck":    "f*ck", // Exact entries still win
+		"f**k":    "",     // "fk" is not a word
+	} {
+		entry, ok := matchToken(dict, token, MatchOptions{Mode: MatchWord}, nil)
+		if ok != (want != "") || (ok && entry != want) {
+			t.Errorf("matchToken(%q) = %q, %v, want %q", token, entry, ok, want)
+		}
+	}
+}
+
+func TestMatchModes(t *testing.T) {
+	dict := testDictionary(wordList{
+		"ass":      {Category: "vulgar", Severity: 2},
+		"shit":     {Category: "vulgar", Severity: 2},
+		"shithead": {Category: "insult", Severity: 3},
+		"cunt":     {Category: "vulgar", Severity: 4},
+		"ho":       {Category: "insult", Severity: 2},
+	}).withAllowlist(wordList{"scunthorpe": {}})
+
+	tests := []struct {
+		token     string
+		word      string // Expected entry in word mode, empty for no match
+		substring string // Expected entry in substring mode
+	}{
+		{"ass", "ass", "ass"},
+		{"Shit!", "shit", "shit"},
+		{"dumbass", "", "ass"},
+		{"bullshitting", "", "shit"},
+		{"shitheads", "", "shithead"}, // Longest entry wins
+		{"assessment", "", "ass"},     // Why substring mode is opt-in
+		{"Scunthorpe", "", ""},        // Allowlisted words aren't searched
+		{"hotel", "", ""},             // Entries shorter than minSubstringLength are skipped
+		{"hello", "", ""},
+	}
+	for _, tt := range tests {
+		for mode, want := range map[MatchMode]string{MatchWord: tt.word, MatchSubstring: tt.substring} {
+			entry, ok := matchToken(dict, tt.token, MatchOptions{Mode: mode}, nil)
+			if ok != (want != "") || (ok && entry != want) {
+				t.Errorf("%s mode: matchToken(%q) = %q, %v, want %q", mode, tt.token, entry, ok, want)
+			}
+		}
+	}
+}
+
+func TestParseMatchMode(t *testing.T) {
+	for raw, want := range map[string]MatchMode{"word": MatchWord, "substring": MatchSubstring} {
+		if got, err := parseMatchMode(raw); err != nil || got != want {
+			t.Errorf("parseMatchMode(%q) = %q, %v", raw, got, err)
+		}
+	}
+	if _, err := parseMatchMode("fuzzy"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestDefaultMatchModeIsWord(t *testing.T) {
+	if defaultMatchMode != MatchWord {
+		t.Errorf("default match mode = %q, substring matching must be opt-in", defaultMatchMode)
+	}
+}
+
+func TestParseAllowParam(t *testing.T) {
+	got := parseAllowParam(" Damn, ,HELL ,")
+	if want := []string{"damn", "hell"}; !slices.Equal(got, want) {
+		t.Errorf("parseAllowParam = %q, want %q", got, want)
+	}
+	if got := parseAllowParam(""); len(got) != 0 {
+		t.Errorf("parseAllowParam(\"\") = %q", got)
+	}
+}
+
+func TestAllowedWordNotFlagged(t *testing.T) {
+	withoutFallbacks(t)
+	previous := currentDictionary()
+	setDictionary(previous.withAllowlist(wordList{"damn": {}}))
+	t.Cleanup(func() { setDictionary(previous) })
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "damn it", "oh shit")}, nil
+	}))
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"shit"}},      // damn is on the allowlist file
+		{"&allow=SHIT", []string{}}, // and shit allowed for this request
+		{"&allow=bogus,", []string{"shit"}},
+	} {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=allowlist01&no_cache=true"+tt.query, nil))
+		var response TranscriptResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err, rec.Body)
+		}
+		if !slices.Equal(response.ProfaneWords, tt.want) {
+			t.Errorf("%q: profane words = %q, want %q", tt.query, response.ProfaneWords, tt.want)
+		}
+	}
+}
+
+func TestNormalizeToken(t *testing.T) {
+	for token, want := range map[string]string{
+		"sh1t":  "shit",
+		"f@ck":  "fack",
+		"a$$":   "ass",
+		"b1tch": "bitch",
+		"sh1t3": "shite",
+		"4ss":   "ass",
+		"c0ck":  "cock",
+		"hello": "hello", // Nothing to undo
+		"2024":  "2o2a",  // Numbers are rewritten too, which is why it's opt-in
+		"":      "",
+		"$h!t":  "sh!t", // Only the table's characters change
+	} {
+		if got := normalizeToken(token); got != want {
+			t.Errorf("normalizeToken(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
+
+func TestNormalizeTokenNoAllocation(t *testing.T) {
+	if allocs := testing.AllocsPerRun(100, func() { normalizeToken("perfectly") }); allocs != 0 {
+		t.Errorf("normalizeToken allocated %v times for a plain word", allocs)
+	}
+}
+
+func TestMatchTokenLeetspeak(t *testing.T) {
+	previous := normalizeLeetspeak
+	t.Cleanup(func() { normalizeLeetspeak = previous })
+
+	dict := testDictionary(wordList{"shit": {}, "ass": {}, "bitch": {}})
+	for _, enabled := range []bool{false, true} {
+		normalizeLeetspeak = enabled
+		for token, want := range map[string]string{
+			"sh1t":   "shit",
+			"a$$!":   "ass",
+			"B1TCH":  "bitch",
+			"(sh1t)": "shit",
+			"1337":   "",
+		} {
+			if !enabled {
+				want = ""
+			}
+			entry, ok := matchToken(dict, token, MatchOptions{Mode: MatchWord}, nil)
+			if ok != (want != "") || (ok && entry != want) {
+				t.Errorf("leetspeak %v: matchToken(%q) = %q, %v, want %q", enabled, token, entry, ok, want)
+			}
+		}
+	}
+}
+
+func BenchmarkNormalizeToken(b *testing.B) {
+	tokens := strings.Fields(benchmarkParagraph + " sh1t f@ck a$$")
+	for b.Loop() {
+		for _, token := range tokens {
+			normalizeToken(token)
+		}
+	}
+}
+
+func TestFindProfanityPhrases(t *testing.T) {
+	dict := testDictionary(wordList{
+		"bitch":          {Category: "insult", Severity: 2},
+		"son of a bitch": {Category: "insult", Severity: 3},
+		"shut up":        {Category: "rude", Severity: 1},
+		"go to hell":     {Category: "rude", Severity: 2},
+		"hell":           {Category: "mild", Severity: 1},
+	})
+	tests := []struct {
+		name string
+		text string
+		want map[string]int
+	}{
+		{"two-word phrase", "oh Shut Up already", map[string]int{"shut up": 1}},
+		{"three-word phrase", "just go to hell.", map[string]int{"go to hell": 1}},
+		{"longest entry wins, its words aren't counted again", "you son of a bitch", map[string]int{"son of a bitch": 1}},
+		{"punctuation between words", "son, of a... bitch!", map[string]int{"son of a bitch": 1}},
+		{"phrase split over a line break", "shut\nup", map[string]int{"shut up": 1}},
+		{"words on their own", "what the hell, bitch", map[string]int{"hell": 1, "bitch": 1}},
+		{"partial phrase", "go to the shop", map[string]int{}},
+		{"phrase at the very end", "bitch please go to hell", map[string]int{"bitch": 1, "go to hell": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := findProfanity(dict, tt.text, MatchOptions{Mode: MatchWord})
+			if !maps.Equal(matches.counts, tt.want) {
+				t.Errorf("counts = %v, want %v", matches.counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindProfanityPhraseAllowed(t *testing.T) {
+	dict := testDictionary(wordList{"shut up": {}, "up": {}})
+	matches := findProfanity(dict, "shut up", MatchOptions{Mode: MatchWord, Allow: []string{"shut up"}})
+	// The allowed phrase is skipped, its words are still checked on their own
+	if want := map[string]int{"up": 1}; !maps.Equal(matches.counts, want) {
+		t.Errorf("counts = %v, want %v", matches.counts, want)
+	}
+}
+
+func TestSingleWordDictionarySkipsPhrases(t *testing.T) {
+	dict := testDictionary(wordList{"shit": {}, "damn": {}})
+	if dict.maxPhrase != 1 {
+		t.Errorf("maxPhrase = %d, want 1", dict.maxPhrase)
+	}
+	if n, _ := matchPhrase(dict, []string{"shit", "damn"}, MatchOptions{}); n != 0 {
+		t.Errorf("matchPhrase = %d without phrase entries", n)
+	}
+}
+
+func TestTokenizeMixedScripts(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", "world"}},
+		{"  tabs\tand\nnewlines ", []string{"tabs", "and", "newlines"}},
+		{"你好世界", []string{"你", "好", "世", "界"}},
+		{"hello 你好 world", []string{"hello", "你", "好", "world"}},
+		{"this is クソ!", []string{"this", "is", "ク", "ソ", "!"}},
+		{"ok你好ok", []string{"ok", "你", "好", "ok"}},
+		{"안녕하세요 친구", []string{"안녕하세요", "친구"}}, // Korean uses spaces
+		{"Привет, мир", []string{"Привет,", "мир"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	for _, text := range []string{"héllo wörld", "  Привет, мир ", "this is クソ!", "ok你好ok", "😀 fuck 😀", ""} {
+		tokens, offsets := tokenizeOffsets(text)
+		if !slices.Equal(tokens, tokenize(text)) {
+			t.Errorf("tokenizeOffsets(%q) tokens = %q, want %q", text, tokens, tokenize(text))
+		}
+		if len(offsets) != len(tokens) {
+			t.Fatalf("tokenizeOffsets(%q): %d offsets for %d tokens", text, len(offsets), len(tokens))
+		}
+		// Offsets are in bytes and slice out each token
+		for i, offset := range offsets {
+			if got := text[offset.start:offset.end]; got != tokens[i] {
+				t.Errorf("tokenizeOffsets(%q): offset %d = %q, want %q", text, i, got, tokens[i])
+			}
+		}
+	}
+}
+
+func TestMatchOffsetsMultibyte(t *testing.T) {
+	dict := testDictionary(wordList{
+		"fuck":           {Category: "vulgar", Severity: 3},
+		"son of a bitch": {Category: "insult", Severity: 3},
+		"クソ":             {Category: "vulgar", Severity: 2},
+		"сука":           {Category: "vulgar", Severity: 3},
+	})
+	tests := []struct {
+		text string
+		want []MatchOffset
+	}{
+		{"naïve fuck", []MatchOffset{{Word: "fuck", Entry: "fuck", Start: 6, End: 10}}},
+		{"😀😀 \"fuck!\"", []MatchOffset{{Word: "fuck", Entry: "fuck", Start: 4, End: 8}}},
+		{"это сука, да", []MatchOffset{{Word: "сука", Entry: "сука", Start: 4, End: 8}}},
+		{"これはクソだ。クソ!", []MatchOffset{
+			{Word: "クソ", Entry: "クソ", Start: 3, End: 5},
+			{Word: "クソ", Entry: "クソ", Start: 7, End: 9},
+		}},
+		{"é, (son of a bitch).", []MatchOffset{{Word: "son of a bitch", Entry: "son of a bitch", Start: 4, End: 18}}},
+	}
+	for _, tt := range tests {
+		got := findProfanity(dict, tt.text, MatchOptions{Mode: MatchWord}).offsets()
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("offsets(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+		// Code point offsets slice out the word, as clients index the text
+		runes := []rune(tt.text)
+		for _, offset := range got {
+			if word := string(runes[offset.Start:offset.End]); word != offset.Word {
+				t.Errorf("%q[%d:%d] = %q, want %q", tt.text, offset.Start, offset.End, word, offset.Word)
+			}
+		}
+	}
+}
+
+func TestIncludeOffsetsIndexTranscript(t *testing.T) {
+	withoutFallbacks(t)
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "¿qué? 😀 oh shit", "naïve—fuck")}, nil
+	}))
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=offsets0001&include_offsets=true&no_cache=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response TranscriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.MatchOffsets) == 0 {
+		t.Fatalf("no offsets in %s", rec.Body)
+	}
+	runes := []rune(response.Transcript)
+	for _, offset := range response.MatchOffsets {
+		if word := string(runes[offset.Start:offset.End]); word != offset.Word {
+			t.Errorf("transcript[%d:%d] = %q, want %q", offset.Start, offset.End, word, offset.Word)
+		}
+	}
+}
+
+func TestJoinTokens(t *testing.T) {
+	for _, text := range []string{"son of a bitch", "他妈的", "what 他妈的 is this", "クソ野郎"} {
+		if got := joinTokens(tokenize(text)); got != text {
+			t.Errorf("joinTokens(tokenize(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestFindProfanityUnspacedScripts(t *testing.T) {
+	dict := testDictionary(wordList{
+		"他妈的":  {Category: "vulgar", Severity: 3},
+		"クソ":   {Category: "vulgar", Severity: 2},
+		"fuck": {Category: "vulgar", Severity: 3},
+	})
+	tests := []struct {
+		text string
+		want map[string]int
+	}{
+		{"你他妈的在干什么", map[string]int{"他妈的": 1}},
+		{"これはクソだ。クソ!", map[string]int{"クソ": 2}},
+		{"fuck 他妈的 fuck", map[string]int{"fuck": 2, "他妈的": 1}},
+		{"他妈妈的", map[string]int{}},
+	}
+	for _, tt := range tests {
+		matches := findProfanity(dict, tt.text, MatchOptions{Mode: MatchWord})
+		if !maps.Equal(matches.counts, tt.want) {
+			t.Errorf("findProfanity(%q) = %v, want %v", tt.text, matches.counts, tt.want)
+		}
+	}
+}
+
+func TestCollapseRuns(t *testing.T) {
+	tests := []struct {
+		word string
+		keep int
+		want string
+	}{
+		{"shiiiit", 2, "shiit"},
+		{"shiiiit", 1, "shit"},
+		{"fuuuck", 1, "fuck"},
+		{"cooool", 2, "cool"},
+		{"bookkeeper", 1, "bookkeeper"}, // Runs of two are left alone
+		{"aaa", 1, "a"},
+		{"!!!wow", 1, "!!!wow"}, // Only letters are collapsed
+		{"zzzz...", 2, "zz..."},
+		{"ääääh", 1, "äh"},
+		{"", 1, ""},
+	}
+	for _, tt := range tests {
+		if got := collapseRuns(tt.word, tt.keep); got != tt.want {
+			t.Errorf("collapseRuns(%q, %d) = %q, want %q", tt.word, tt.keep, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTokenElongation(t *testing.T) {
+	previous := collapseElongation
+	t.Cleanup(func() { collapseElongation = previous })
+
+	dict := testDictionary(wordList{"shit": {}, "fuck": {}, "ass": {}})
+	tests := []struct {
+		token string
+		want  string // Entry matched with elongation on, empty for none
+	}{
+		{"shiiiit", "shit"},
+		{"fuuuck!", "fuck"},
+		{"FUUUUUUCK", "fuck"},
+		{"asssss", "ass"},
+		{"bookkeeper", ""},
+		{"cooool", ""},
+		{"shiiiiiine", ""},
+	}
+	for _, enabled := range []bool{false, true} {
+		collapseElongation = enabled
+		for _, tt := range tests {
+			want := tt.want
+			if !enabled {
+				want = ""
+			}
+			entry, ok := matchToken(dict, tt.token, MatchOptions{Mode: MatchWord}, nil)
+			if ok != (want != "") || (ok && entry != want) {
+				t.Errorf("elongation %v: matchToken(%q) = %q, %v, want %q", enabled, tt.token, entry, ok, want)
+			}
+		}
+	}
+}
+
+func TestInflectionStems(t *testing.T) {
+	for word, want := range map[string][]string{
+		"fucks":    {"fuck"},
+		"fucked":   {"fuck"},
+		"fucking":  {"fuck"},
+		"fuckers":  {"fuck", "fucker"},
+		"shitting": {"shitt", "shit"},
+		"bitches":  {"bitch", "bitche"},
+		"was":      nil, // Stem too short
+		"shit":     nil,
+	} {
+		got := inflectionStems(word)
+		if !slices.Equal(slices.Sorted(slices.Values(got)), slices.Sorted(slices.Values(want))) {
+			t.Errorf("inflectionStems(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestMatchTokenInflections(t *testing.T) {
+	previous := matchInflections
+	t.Cleanup(func() { matchInflections = previous })
+
+	dict := testDictionary(wordList{"fuck": {}, "shit": {}, "bitch": {}, "ass": {}, "damn": {}})
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"fucks", "fuck"},
+		{"fucked", "fuck"},
+		{"Fucking!", "fuck"},
+		{"fucker", "fuck"},
+		{"shitting", "shit"},
+		{"bitches", "bitch"},
+		{"damned", "damn"},
+		{"asses", "ass"},
+		// Over-stemming guards: only stems in the dictionary count
+		{"class", ""},
+		{"passing", ""},
+		{"assessing", ""},
+		{"bass", ""},
+		{"shitake", ""},
+	}
+	for _, enabled := range []bool{false, true} {
+		matchInflections = enabled
+		for _, tt := range tests {
+			want := tt.want
+			if !enabled {
+				want = ""
+			}
+			entry, ok := matchToken(dict, tt.token, MatchOptions{Mode: MatchWord}, nil)
+			if ok != (want != "") || (ok && entry != want) {
+				t.Errorf("inflections %v: matchToken(%q) = %q, %v, want %q", enabled, tt.token, entry, ok, want)
+			}
+		}
+	}
+}
+
+func TestSplitJoined(t *testing.T) {
+	for word, want := range map[string][]string{
+		"kick-ass":         {"kick", "ass"},
+		"bull/shit":        {"bull", "shit"},
+		"fuck-you/bitch":   {"fuck", "you", "bitch"},
+		"--self--destruct": {"self", "destruct"},
+		"(what)-(the)":     {"what", "the"},
+		"a/-/b":            {"a", "b"},
+		"plain":            {"plain"},
+		"-/-":              nil,
+	} {
+		if got := splitJoined(word); !slices.Equal(got, want) {
+			t.Errorf("splitJoined(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestMatchTokenSplitJoined(t *testing.T) {
+	previous := splitJoinedWords
+	t.Cleanup(func() { splitJoinedWords = previous })
+
+	dict := testDictionary(wordList{"ass": {}, "shit": {}, "fuck": {}})
+	tests := []struct {
+		token string
+		allow []string
+		want  string // Entry matched with splitting on, empty for none
+	}{
+		{"kick-ass", nil, "ass"},
+		{"Bull/Shit!", nil, "shit"},
+		{"fuck-you", nil, "fuck"},
+		{"self-destruct", nil, ""},             // No part is an entry
+		{"pass/fail", nil, ""},                 // Parts must match whole
+		{"kick-ass", []string{"kick-ass"}, ""}, // The allowlisted whole word wins
+		{"kick-ass", []string{"ass"}, ""},
+	}
+	for _, enabled := range []bool{false, true} {
+		splitJoinedWords = enabled
+		for _, tt := range tests {
+			want := tt.want
+			if !enabled {
+				want = ""
+			}
+			entry, ok := matchToken(dict, tt.token, MatchOptions{Mode: MatchWord, Allow: tt.allow}, nil)
+			if ok != (want != "") || (ok && entry != want) {
+				t.Errorf("split %v: matchToken(%q, allow %q) = %q, %v, want %q", enabled, tt.token, tt.allow, entry, ok, want)
+			}
+		}
+	}
+}
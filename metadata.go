@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Metadata fetch policy, independent from the transcript fetch so a slow
+// metadata service can't hold up the profanity verdict
+var (
+	metadataTimeout = 3 * time.Second // Per-attempt timeout
+	metadataRetries = 1               // Extra attempts after the first failure
+	metadataBaseURL = "https://www.youtube.com/oembed"
+	metadataClient  = &http.Client{Transport: proxiedTransport{}}
+)
+
+// VideoMetadata is the subset of YouTube's oEmbed response we pass on
+type VideoMetadata struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// fetchVideoMetadata looks the video up via oEmbed, retrying up to
+// metadataRetries times. Each attempt is bounded by metadataTimeout.
+func fetchVideoMetadata(ctx context.Context, videoID string) (*VideoMetadata, error) {
+	var lastErr error
+	for attempt := 0; attempt <= metadataRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * 250 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		metadata, err := fetchVideoMetadataOnce(ctx, videoID)
+		if err == nil {
+			return metadata, nil
+		}
+		lastErr = err
+		slog.Debug("Metadata attempt failed", "video_id", videoID, "attempt", attempt+1, "error", err)
+	}
+	return nil, lastErr
+}
+
+func fetchVideoMetadataOnce(ctx context.Context, videoID string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("url", "https://www.youtube.com/watch?v="+videoID)
+	query.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataBaseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oEmbed returned status %d", resp.StatusCode)
+	}
+
+	var metadata VideoMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode oEmbed response: %w", err)
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// withMetadataServer points metadata lookups at handler for the rest of the
+// test, with short timeouts
+func withMetadataServer(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	previousURL, previousClient := metadataBaseURL, metadataClient
+	previousTimeout, previousRetries := metadataTimeout, metadataRetries
+	metadataBaseURL, metadataClient = server.URL, server.Client()
+	metadataTimeout, metadataRetries = 20*time.Millisecond, 1
+	t.Cleanup(func() {
+		server.Close()
+		metadataBaseURL, metadataClient = previousURL, previousClient
+		metadataTimeout, metadataRetries = previousTimeout, previousRetries
+	})
+}
+
+func TestFetchVideoMetadata(t *testing.T) {
+	withMetadataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("url"); got != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+			t.Errorf("url = %q", got)
+		}
+		w.Write([]byte(`{"title": "Never Gonna Give You Up", "author_name": "Rick Astley"}`))
+	})
+	metadata, err := fetchVideoMetadata(t.Context(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Title != "Never Gonna Give You Up" || metadata.AuthorName != "Rick Astley" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+}
+
+func TestFetchVideoMetadataTimesOut(t *testing.T) {
+	var attempts atomic.Int32
+	withMetadataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		<-r.Context().Done() // Hang until the client gives up
+	})
+	start := time.Now()
+	if _, err := fetchVideoMetadata(t.Context(), "dQw4w9WgXcQ"); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v, the per-attempt timeout wasn't applied", elapsed)
+	}
+}
+
+func TestMetadataTimeoutKeepsVerdict(t *testing.T) {
+	withoutFallbacks(t)
+	withMetadataServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "what the fuck")}, nil
+	}))
+
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url=metadata001&metadata=true&no_cache=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response["profanity"] != true {
+		t.Errorf("profanity = %v, want true", response["profanity"])
+	}
+	if _, ok := response["metadata"]; ok {
+		t.Errorf("metadata = %v, want it omitted", response["metadata"])
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "profanity_http_requests_total",
+		Help: "HTTP requests served, by route and status code.",
+	}, []string{"route", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "profanity_http_request_duration_seconds",
+		Help:    "End-to-end HTTP request latency, by route.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "profanity_cache_lookups_total",
+		Help: "Result cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	fetchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "profanity_transcript_fetch_failures_total",
+		Help: "Failed transcript fetch attempts, by error type.",
+	}, []string{"type"})
+
+	queueRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "profanity_job_queue_rejections_total",
+		Help: "Jobs turned away by the worker queue, by reason (depth or timeout).",
+	}, []string{"reason"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "profanity_job_queue_depth",
+		Help: "Jobs waiting in the worker queue.",
+	}, func() float64 { return float64(len(jobQueue)) })
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// metricsMiddleware counts requests and records their latency, labelled by
+// route template rather than raw path so video IDs don't explode cardinality
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		requestsTotal.WithLabelValues(route, strconv.Itoa(recorder.status)).Inc()
+		latency := time.Since(start)
+		requestDuration.WithLabelValues(route).Observe(latency.Seconds())
+		stats.recordRequest(latency)
+	})
+}
+
+// fetchErrorType buckets a transcript fetch error for the failure counter
+func fetchErrorType(err error) string {
+	err = classifyFetchError(err)
+	errorStr := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, errYouTubeThrottled):
+		return "throttled"
+	case errors.Is(err, errTranscriptPanic):
+		return "panic"
+	case errors.Is(err, errEmptyTranscript):
+		return "empty"
+	case errors.Is(err, errCaptionKindMissing):
+		return "caption_kind"
+	case errors.Is(err, errNoCaptions):
+		return "captions_not_found"
+	case errors.Is(err, errPrivateVideo):
+		return "private"
+	case errors.Is(err, errVideoUnavailable):
+		return "unavailable"
+	case strings.Contains(errorStr, "timeout"):
+		return "timeout"
+	case strings.Contains(errorStr, "connection"), strings.Contains(errorStr, "network"), strings.Contains(errorStr, "temporary"):
+		return "network"
+	}
+	return "other"
+}
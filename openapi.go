@@ -0,0 +1,182 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openapiSpec describes the routes. Keep it in step with the router in main
+// when adding endpoints or query parameters. The component schemas it refers
+// to are generated from openapiSchemaTypes, so response fields can't drift.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// openapiSchemaTypes are the request and response types published under
+// components/schemas, by schema name
+var openapiSchemaTypes = map[string]reflect.Type{
+	"TranscriptResponse": reflect.TypeFor[TranscriptResponse](),
+	"ErrorResponse":      reflect.TypeFor[ErrorResponse](),
+	"AttemptResult":      reflect.TypeFor[AttemptResult](),
+	"WordCount":          reflect.TypeFor[WordCount](),
+	"Segment":            reflect.TypeFor[Segment](),
+	"MatchContext":       reflect.TypeFor[MatchContext](),
+	"MatchOffset":        reflect.TypeFor[MatchOffset](),
+	"TimeRange":          reflect.TypeFor[TimeRange](),
+	"TrackResult":        reflect.TypeFor[TrackResult](),
+	"VideoMetadata":      reflect.TypeFor[VideoMetadata](),
+	"AnalysisResponse":   reflect.TypeFor[AnalysisResponse](),
+	"AnalysisVerdict":    reflect.TypeFor[AnalysisVerdict](),
+	"AnalysisStats":      reflect.TypeFor[AnalysisStats](),
+	"AnalysisCoverage":   reflect.TypeFor[AnalysisCoverage](),
+	"CaptionLanguage":    reflect.TypeFor[CaptionLanguage](),
+	"ExistsResponse":     reflect.TypeFor[ExistsResponse](),
+	"BatchRequest":       reflect.TypeFor[BatchRequest](),
+	"BatchItem":          reflect.TypeFor[BatchItem](),
+	"VideoResult":        reflect.TypeFor[VideoResult](),
+	"BatchJobAccepted":   reflect.TypeFor[BatchJobAccepted](),
+	"BatchJobPage":       reflect.TypeFor[BatchJobPage](),
+	"BatchProgress":      reflect.TypeFor[BatchProgress](),
+	"CompareResponse":    reflect.TypeFor[CompareResponse](),
+	"CompareSummary":     reflect.TypeFor[CompareSummary](),
+	"HealthResponse":     reflect.TypeFor[HealthResponse](),
+	"VersionResponse":    reflect.TypeFor[VersionResponse](),
+	"ReloadResponse":     reflect.TypeFor[ReloadResponse](),
+	"StatsResponse":      reflect.TypeFor[StatsResponse](),
+	"ExplainResponse":    reflect.TypeFor[ExplainResponse](),
+	"ExplainStep":        reflect.TypeFor[ExplainStep](),
+	"TokensResponse":     reflect.TypeFor[TokensResponse](),
+	"DebugToken":         reflect.TypeFor[DebugToken](),
+}
+
+// openapiDocument is the spec with its schemas filled in, see
+// buildOpenAPIDocument
+var openapiDocument []byte
+
+// buildOpenAPIDocument adds the generated schemas to openapiSpec
+func buildOpenAPIDocument() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openapiSpec, &doc); err != nil {
+		return nil, err
+	}
+	names := make(map[reflect.Type]string, len(openapiSchemaTypes))
+	for name, t := range openapiSchemaTypes {
+		names[t] = name
+	}
+	schemas := make(map[string]interface{}, len(openapiSchemaTypes))
+	for name, t := range openapiSchemaTypes {
+		schemas[name] = structSchema(t, names)
+	}
+	components, _ := doc["components"].(map[string]interface{})
+	if components == nil {
+		components = make(map[string]interface{})
+		doc["components"] = components
+	}
+	components["schemas"] = schemas
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// structSchema describes a struct the way encoding/json writes it. Fields
+// without omitempty are required, embedded structs are flattened.
+func structSchema(t reflect.Type, names map[reflect.Type]string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = typeSchema(field.Type, names)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// typeSchema describes any field type, referring to named schemas where
+// there is one
+func typeSchema(t reflect.Type, names map[reflect.Type]string) map[string]interface{} {
+	if name, ok := names[t]; ok {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := typeSchema(t.Elem(), names)
+		if _, isRef := schema["$ref"]; isRef {
+			// Siblings of $ref are ignored in OpenAPI 3.0
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), names)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), names)}
+	case reflect.Struct:
+		return structSchema(t, names)
+	}
+	return map[string]interface{}{}
+}
+
+// openapiHandler serves the OpenAPI document
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiDocument)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>YouTube Profanity Check API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// docsHandler serves Swagger UI for the OpenAPI document
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
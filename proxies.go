@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cooldown of a proxy YouTube blocked, doubled for every block in a row up
+// to maxProxyCooldown
+const (
+	proxyCooldown    = 5 * time.Minute
+	maxProxyCooldown = time.Hour
+)
+
+// proxyPool holds the proxies from YT_PROXY_URL. Requests go through the
+// first one that isn't cooling down, in the configured order. A proxy YouTube
+// blocks cools down so the others are preferred, and fetchTranscript retries
+// a blocked fetch through the next one while any is left.
+type proxyPool struct {
+	mu      sync.Mutex
+	proxies []*proxyState
+	now     func() time.Time
+}
+
+// proxyState is one proxy and how YouTube has been treating it
+type proxyState struct {
+	url          *url.URL
+	transport    http.RoundTripper // Sends requests through this proxy
+	blocks       int               // Blocks in a row, reset by a successful request
+	blockedUntil time.Time
+}
+
+// youtubeProxies is nil unless YT_PROXY_URL is set
+var youtubeProxies *proxyPool
+
+// parseProxyURLs validates the comma separated YT_PROXY_URL list
+func parseProxyURLs(raw string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		proxyURL, err := parseProxyURL(entry)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, proxyURL)
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("no proxies listed")
+	}
+	return proxies, nil
+}
+
+// newProxyPool gives each proxy its own copy of youtubeTransport, so
+// connections through it are kept and reused like any other
+func newProxyPool(proxies []*url.URL) *proxyPool {
+	pool := &proxyPool{now: time.Now}
+	for _, proxyURL := range proxies {
+		transport := youtubeTransport.Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		pool.proxies = append(pool.proxies, &proxyState{url: proxyURL, transport: transport})
+	}
+	return pool
+}
+
+// pick returns the proxy to use next: the first one not cooling down, or the
+// one that is done cooling down soonest. It returns nil without proxies.
+func (p *proxyPool) pick() *proxyState {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var best *proxyState
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.blockedUntil) {
+			return proxy
+		}
+		if best == nil || proxy.blockedUntil.Before(best.blockedUntil) {
+			best = proxy
+		}
+	}
+	return best
+}
+
+// available reports whether some proxy isn't cooling down, so a blocked
+// fetch is worth retrying through it
+func (p *proxyPool) available() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.blockedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// report records how a request through proxy went. A block starts its
+// cooldown; any other outcome means YouTube still lets it through.
+func (p *proxyPool) report(proxy *proxyState, err error) {
+	if p == nil || proxy == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !errors.Is(err, errYouTubeThrottled) {
+		proxy.blocks = 0
+		return
+	}
+	proxy.blocks++
+	cooldown := min(proxyCooldown<<(min(proxy.blocks, 8)-1), maxProxyCooldown)
+	proxy.blockedUntil = p.now().Add(cooldown)
+	slog.Warn("YouTube blocked a proxy, preferring the others", "proxy", proxy.url.Redacted(),
+		"blocks", proxy.blocks, "cooldown", cooldown)
+}
+
+type proxyContextKey struct{}
+
+// withProxy makes req go through proxy, see proxiedTransport
+func withProxy(req *http.Request, proxy *proxyState) *http.Request {
+	if proxy == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, proxy))
+}
+
+// proxiedTransport sends each request through the proxy chosen with
+// withProxy, or else the one youtubeProxies picks. Without proxies it is
+// youtubeTransport.
+type proxiedTransport struct{}
+
+func (proxiedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy, _ := req.Context().Value(proxyContextKey{}).(*proxyState)
+	if proxy == nil {
+		proxy = youtubeProxies.pick()
+	}
+	if proxy == nil {
+		return youtubeTransport.RoundTrip(req)
+	}
+	return proxy.transport.RoundTrip(req)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// fakeProxy answers every request with status and body, counting them
+func fakeProxy(status int, body string, requests *atomic.Int32) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	}
+}
+
+// withTestProxies swaps in a pool of the given transports for the rest of
+// the test, named proxy-a, proxy-b... and driven by the returned clock
+func withTestProxies(t *testing.T, transports ...http.RoundTripper) (*proxyPool, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := &proxyPool{now: func() time.Time { return now }}
+	for i, transport := range transports {
+		proxyURL := &url.URL{Scheme: "http", Host: "proxy-" + string(rune('a'+i)) + ":8080"}
+		pool.proxies = append(pool.proxies, &proxyState{url: proxyURL, transport: transport})
+	}
+	previous := youtubeProxies
+	youtubeProxies = pool
+	t.Cleanup(func() { youtubeProxies = previous })
+	return pool, &now
+}
+
+func TestParseProxyURLs(t *testing.T) {
+	proxies, err := parseProxyURLs(" http://a:8080, socks5://user:pw@b:1080 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 2 || proxies[0].Host != "a:8080" || proxies[1].Redacted() != "socks5://user:xxxxx@b:1080" {
+		t.Errorf("proxies = %v", proxies)
+	}
+	for _, raw := range []string{"", " , ", "http://a:8080,ftp://b", "http://a:8080,http://"} {
+		if _, err := parseProxyURLs(raw); err == nil {
+			t.Errorf("parseProxyURLs(%q) accepted", raw)
+		}
+	}
+}
+
+func TestProxyPoolCooldown(t *testing.T) {
+	var requests atomic.Int32
+	pool, now := withTestProxies(t, fakeProxy(200, "ok", &requests), fakeProxy(200, "ok", &requests))
+	a, b := pool.proxies[0], pool.proxies[1]
+	blocked := errors.Join(errYouTubeThrottled)
+
+	if pool.pick() != a {
+		t.Fatal("first proxy not preferred")
+	}
+	pool.report(a, blocked)
+	if pool.pick() != b || !pool.available() {
+		t.Error("blocked proxy still preferred")
+	}
+	pool.report(b, blocked)
+	if pool.available() {
+		t.Error("available with every proxy blocked")
+	}
+	if pool.pick() != a {
+		t.Error("didn't fall back to the proxy done cooling down first")
+	}
+
+	*now = now.Add(proxyCooldown)
+	if pool.pick() != a {
+		t.Error("proxy not used again after its cooldown")
+	}
+	// Blocked again right away, so it stays out for longer
+	pool.report(a, blocked)
+	*now = now.Add(proxyCooldown)
+	if pool.pick() != b {
+		t.Error("proxy blocked twice in a row came back after one cooldown")
+	}
+	pool.report(b, nil)
+	if b.blocks != 0 {
+		t.Errorf("blocks = %d after a successful request", b.blocks)
+	}
+}
+
+// proxiedFetcher fetches through htmlFetcher like the transcript library does
+func proxiedFetcher(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+	if _, err := (htmlFetcher{}).Fetch("https://www.youtube.com/watch?v="+videoID, nil); err != nil {
+		return nil, err
+	}
+	return []yt_transcript_models.Transcript{testTranscript(langs[0], captionsManual, "hello there")}, nil
+}
+
+func TestBlockedFetchRetriesThroughNextProxy(t *testing.T) {
+	noRetrySleep(t)
+	var blockedRequests, okRequests atomic.Int32
+	pool, _ := withTestProxies(t,
+		fakeProxy(http.StatusTooManyRequests, "", &blockedRequests),
+		fakeProxy(http.StatusOK, "<html>video page</html>", &okRequests))
+
+	_, lang, attempts, err := fetchTranscript(context.Background(), fetcherFunc(proxiedFetcher), "proxy000001", []string{"en"}, captionsAny)
+	if err != nil || lang != "en" {
+		t.Fatalf("fetchTranscript = %q, %v", lang, err)
+	}
+	if blockedRequests.Load() != 1 || okRequests.Load() != 1 {
+		t.Errorf("requests: blocked proxy %d, working proxy %d, want 1 each", blockedRequests.Load(), okRequests.Load())
+	}
+	if attempts[0].Attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts[0].Attempts)
+	}
+	if pool.proxies[0].blocks != 1 {
+		t.Errorf("blocked proxy's blocks = %d, want 1", pool.proxies[0].blocks)
+	}
+
+	// The next video goes straight to the working proxy
+	if _, _, _, err := fetchTranscript(context.Background(), fetcherFunc(proxiedFetcher), "proxy000002", []string{"en"}, captionsAny); err != nil {
+		t.Fatal(err)
+	}
+	if blockedRequests.Load() != 1 || okRequests.Load() != 2 {
+		t.Errorf("requests: blocked proxy %d, working proxy %d", blockedRequests.Load(), okRequests.Load())
+	}
+}
+
+func TestBlockedEverywhereGivesUp(t *testing.T) {
+	noRetrySleep(t)
+	var requests atomic.Int32
+	withTestProxies(t,
+		fakeProxy(http.StatusOK, "please confirm you're not a bot", &requests),
+		fakeProxy(http.StatusTooManyRequests, "", &requests))
+
+	_, _, attempts, err := fetchTranscript(context.Background(), fetcherFunc(proxiedFetcher), "proxy000003", []string{"en", "es"}, captionsAny)
+	if !errors.Is(err, errYouTubeThrottled) {
+		t.Fatalf("err = %v, want errYouTubeThrottled", err)
+	}
+	// One attempt per proxy, then no other language is tried
+	if requests.Load() != 2 || len(attempts) != 1 {
+		t.Errorf("requests = %d, languages tried = %d", requests.Load(), len(attempts))
+	}
+}
+
+func TestProxyRetriesStayWithinBudget(t *testing.T) {
+	noRetrySleep(t)
+	var requests atomic.Int32
+	blocking := fakeProxy(http.StatusTooManyRequests, "", &requests)
+	withTestProxies(t, blocking, blocking, blocking, blocking, blocking)
+
+	if _, _, _, err := fetchTranscript(context.Background(), fetcherFunc(proxiedFetcher), "proxy000004", []string{"en"}, captionsAny); !errors.Is(err, errYouTubeThrottled) {
+		t.Fatalf("err = %v, want errYouTubeThrottled", err)
+	}
+	if got := requests.Load(); got != maxFetchAttempts {
+		t.Errorf("requests = %d, want %d", got, maxFetchAttempts)
+	}
+}
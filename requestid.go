@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the ID that ties log lines to a request. Clients may
+// supply their own, otherwise one is generated, and it's echoed back either way.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied IDs so they can't bloat the logs
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestIDMiddleware assigns every request an ID, stores it in the request
+// context and sets it on the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts non-empty, reasonably short IDs of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFrom returns the request ID stored in ctx, if any
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns a logger that tags every line with the request ID
+func requestLogger(ctx context.Context) *slog.Logger {
+	if id := requestIDFrom(ctx); id != "" {
+		return slog.With("request_id", id)
+	}
+	return slog.Default()
+}
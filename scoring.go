@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// repetitionExponent controls how much repeating the same word adds to the
+// severity score. See repetitionScore.
+var repetitionExponent = 0.5
+
+// repetitionScore folds per-word hit counts into a single severity number
+// that grows sub-linearly with repetition:
+//
+//	score = Σ count(word) ^ exponent
+//
+// With an exponent of 1 every occurrence counts fully; with 0 each distinct
+// word counts once no matter how often it is repeated. The default of 0.5
+// means a word said 30 times weighs about 5.5x a word said once, so one
+// heavily repeated word can't dominate the score. The result is rounded to
+// two decimals.
+func repetitionScore(counts map[string]int, exponent float64) float64 {
+	var score float64
+	for _, count := range counts {
+		if count > 0 {
+			score += math.Pow(float64(count), exponent)
+		}
+	}
+	return math.Round(score*100) / 100
+}
+
+// audienceRating is a named bucket for results whose severity score is at
+// most MaxScore
+type audienceRating struct {
+	Name     string
+	MaxScore float64
+}
+
+// defaultAudienceRatings maps severity scores to ratings:
+//
+//	G      score 0 (nothing profane found)
+//	PG     score up to 1 (a single isolated word)
+//	PG-13  score up to 4
+//	R      anything above
+const defaultAudienceRatings = "G:0,PG:1,PG-13:4,R"
+
+var audienceRatings = mustParseAudienceRatings(defaultAudienceRatings)
+
+// parseAudienceRatings parses "NAME:MAX,NAME:MAX,...,NAME" where each MAX is
+// the highest severity score that still earns that rating. Buckets must be in
+// increasing order and the last one, which has no MAX, catches everything
+// above.
+func parseAudienceRatings(raw string) ([]audienceRating, error) {
+	entries := strings.Split(raw, ",")
+	ratings := make([]audienceRating, 0, len(entries))
+	for i, entry := range entries {
+		name, max, hasMax := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			return nil, fmt.Errorf("empty rating name in %q", raw)
+		}
+		last := i == len(entries)-1
+		if last != !hasMax {
+			return nil, fmt.Errorf("only the last rating may omit its maximum score, got %q", entry)
+		}
+
+		rating := audienceRating{Name: name, MaxScore: math.Inf(1)}
+		if hasMax {
+			value, err := strconv.ParseFloat(max, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maximum score for rating %s: %q", name, max)
+			}
+			if len(ratings) > 0 && value <= ratings[len(ratings)-1].MaxScore {
+				return nil, fmt.Errorf("rating %s must have a higher maximum than %s", name, ratings[len(ratings)-1].Name)
+			}
+			rating.MaxScore = value
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, nil
+}
+
+func mustParseAudienceRatings(raw string) []audienceRating {
+	ratings, err := parseAudienceRatings(raw)
+	if err != nil {
+		fatal("Invalid audience ratings", "error", err)
+	}
+	return ratings
+}
+
+// rateAudience returns the first rating whose maximum covers the score
+func rateAudience(score float64, ratings []audienceRating) string {
+	for _, rating := range ratings {
+		if score <= rating.MaxScore {
+			return rating.Name
+		}
+	}
+	return ratings[len(ratings)-1].Name
+}
+
+// Default thresholds for flagging a video, see meetsThreshold. MIN_HITS and
+// MIN_DENSITY override them, min_hits and min_density override them per
+// request.
+var (
+	minHitsDefault    = 1
+	minDensityDefault = 0.0
+)
+
+// meetsThreshold reports whether a scan found enough profanity for the video
+// to be flagged: at least minHits occurrences making up at least minDensity
+// of the words scanned. With the defaults any single hit flags the video.
+func meetsThreshold(hits int, density float64, minHits int, minDensity float64) bool {
+	return hits > 0 && hits >= minHits && density >= minDensity
+}
+
+// cleanMinWords is how many words a clean transcript needs before its verdict
+// is trusted, see CLEAN_MIN_WORDS. Short auto-captions often miss words.
+var cleanMinWords = 200
+
+// Confidence levels for clean verdicts
+const (
+	confidenceHigh   = "high"
+	confidenceMedium = "medium"
+	confidenceLow    = "low"
+)
+
+// cleanConfidence rates how far a clean verdict can be trusted and explains
+// why. Every caveat lowers it a level; too few words makes it low outright.
+func cleanConfidence(response TranscriptResponse) (string, []string) {
+	var notes []string
+	short := response.WordsScanned < cleanMinWords
+	if short {
+		notes = append(notes, fmt.Sprintf("Only %d words were scanned, fewer than %d", response.WordsScanned, cleanMinWords))
+	}
+	if response.CaptionType == captionsAuto {
+		notes = append(notes, "Scanned auto-generated captions, which can miss or mishear words")
+	}
+	if response.Partial || response.Truncated || response.SegmentsScanned < response.SegmentsTotal {
+		notes = append(notes, fmt.Sprintf("Only %d of %d segments were scanned", response.SegmentsScanned, response.SegmentsTotal))
+	}
+	if response.ProfanityCount > 0 {
+		notes = append(notes, fmt.Sprintf("Found %d hits, below the flagging threshold", response.ProfanityCount))
+	}
+
+	switch {
+	case short || len(notes) >= 2:
+		return confidenceLow, notes
+	case len(notes) == 1:
+		return confidenceMedium, notes
+	}
+	return confidenceHigh, notes
+}
+
+// Scales for the profanity score components, see profanityScore
+const (
+	scoreCountScale      = 5    // Hits for the count component to reach about 63%
+	scoreDensityCeiling  = 0.01 // Density at which the density component maxes out
+	scoreSeverityCeiling = 3    // Severity at which the severity component maxes out
+)
+
+// scoreWeights sets how much each component counts towards the profanity
+// score. Only their ratios matter.
+type scoreWeights struct {
+	Count    float64
+	Density  float64
+	Severity float64
+}
+
+// defaultScoreWeights favours how much profanity there is over how bad the
+// worst word is
+const defaultScoreWeights = "count:0.4,density:0.4,severity:0.2"
+
+var profanityScoreWeights = mustParseScoreWeights(defaultScoreWeights)
+
+// parseScoreWeights parses "count:W,density:W,severity:W". Components left
+// out weigh nothing, and at least one weight must be positive.
+func parseScoreWeights(raw string) (scoreWeights, error) {
+	var weights scoreWeights
+	for _, entry := range strings.Split(raw, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return scoreWeights{}, fmt.Errorf("expected name:weight, got %q", entry)
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return scoreWeights{}, fmt.Errorf("invalid weight for %s: %q", name, value)
+		}
+		switch name {
+		case "count":
+			weights.Count = weight
+		case "density":
+			weights.Density = weight
+		case "severity":
+			weights.Severity = weight
+		default:
+			return scoreWeights{}, fmt.Errorf("unknown score component %q, expected count, density or severity", name)
+		}
+	}
+	if weights.Count+weights.Density+weights.Severity == 0 {
+		return scoreWeights{}, fmt.Errorf("at least one weight must be positive in %q", raw)
+	}
+	return weights, nil
+}
+
+func mustParseScoreWeights(raw string) scoreWeights {
+	weights, err := parseScoreWeights(raw)
+	if err != nil {
+		fatal("Invalid profanity score weights", "error", err)
+	}
+	return weights
+}
+
+// profanityScore folds a scan into a single number from 0 to 100 as the
+// weighted average of three components, each between 0 and 1:
+//
+//	count    = 1 - e^(-hits / 5)        1 hit ≈ 0.18, 5 ≈ 0.63, 15 ≈ 0.95
+//	density  = min(density / 0.01, 1)  full at one profane word in 100
+//	severity = min(max severity / 3, 1)
+//
+//	score = round(100 × Σ weight × component / Σ weight)
+//
+// A clean scan always scores 0.
+func profanityScore(hits int, density float64, maxSeverity int, weights scoreWeights) int {
+	if hits == 0 {
+		return 0
+	}
+	count := 1 - math.Exp(-float64(hits)/scoreCountScale)
+	densityPart := math.Min(density/scoreDensityCeiling, 1)
+	severity := math.Min(float64(maxSeverity)/scoreSeverityCeiling, 1)
+	total := weights.Count + weights.Density + weights.Severity
+	score := (weights.Count*count + weights.Density*densityPart + weights.Severity*severity) / total
+	return int(math.Round(score * 100))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestRepetitionScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		counts   map[string]int
+		exponent float64
+		want     float64
+	}{
+		{"clean", map[string]int{}, 0.5, 0},
+		{"one word once", map[string]int{"shit": 1}, 0.5, 1},
+		{"repeats grow sub-linearly", map[string]int{"shit": 4}, 0.5, 2},
+		{"thirty repeats", map[string]int{"shit": 30}, 0.5, 5.48},
+		{"distinct words add up", map[string]int{"shit": 4, "damn": 1}, 0.5, 3},
+		{"exponent 1 counts every hit", map[string]int{"shit": 4, "damn": 1}, 1, 5},
+		{"exponent 0 counts distinct words", map[string]int{"shit": 4, "damn": 9}, 0, 2},
+		{"zero counts are ignored", map[string]int{"shit": 0}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repetitionScore(tt.counts, tt.exponent); got != tt.want {
+				t.Errorf("repetitionScore = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateAudienceDefaults(t *testing.T) {
+	ratings := mustParseAudienceRatings(defaultAudienceRatings)
+	tests := []struct {
+		name   string
+		counts map[string]int
+		want   string
+	}{
+		{"clean", map[string]int{}, "G"},
+		{"one isolated word", map[string]int{"damn": 1}, "PG"},
+		{"a few words", map[string]int{"damn": 1, "shit": 4}, "PG-13"},
+		{"repeated swearing", map[string]int{"shit": 16}, "PG-13"},
+		{"lots of swearing", map[string]int{"shit": 9, "fuck": 9}, "R"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := repetitionScore(tt.counts, 0.5)
+			if got := rateAudience(score, ratings); got != tt.want {
+				t.Errorf("rateAudience(%v) = %s, want %s", score, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAudienceRatings(t *testing.T) {
+	ratings, err := parseAudienceRatings("family:0, teen:2.5, adult")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for score, want := range map[float64]string{0: "family", 0.5: "teen", 2.5: "teen", 2.6: "adult", 1000: "adult"} {
+		if got := rateAudience(score, ratings); got != want {
+			t.Errorf("rateAudience(%v) = %s, want %s", score, got, want)
+		}
+	}
+
+	for _, raw := range []string{
+		"",               // No ratings
+		"G:0,PG:1",       // Last rating has a maximum
+		"G,PG:1,R",       // Earlier rating without one
+		"G:0,PG:x,R",     // Not a number
+		"G:1,PG:1,R",     // Not increasing
+		"G:0,:1,R",       // Empty name
+		"G:2,PG:1,R:5,X", // Decreasing
+	} {
+		if _, err := parseAudienceRatings(raw); err == nil {
+			t.Errorf("parseAudienceRatings(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestMeetsThreshold(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		hits       int
+		density    float64
+		minHits    int
+		minDensity float64
+		want       bool
+	}{
+		{"defaults, no hits", 0, 0, 1, 0, false},
+		{"defaults, one hit", 1, 0.001, 1, 0, true},
+		{"one short of min_hits", 2, 0.5, 3, 0, false},
+		{"exactly min_hits", 3, 0.5, 3, 0, true},
+		{"one over min_hits", 4, 0.5, 3, 0, true},
+		{"just under min_density", 1, 0.0499, 1, 0.05, false},
+		{"exactly min_density", 1, float64(1) / 20, 1, 0.05, true},
+		{"over min_density", 2, float64(2) / 20, 1, 0.05, true},
+		{"both met exactly", 3, float64(3) / 60, 3, 0.05, true},
+		{"enough hits, too sparse", 3, float64(3) / 61, 3, 0.05, false},
+		{"dense enough, too few hits", 2, float64(2) / 40, 3, 0.05, false},
+		{"min_density of zero still needs a hit", 0, 0, 0, 0, false},
+	} {
+		if got := meetsThreshold(tc.hits, tc.density, tc.minHits, tc.minDensity); got != tc.want {
+			t.Errorf("%s: meetsThreshold(%d, %v, %d, %v) = %v, want %v",
+				tc.name, tc.hits, tc.density, tc.minHits, tc.minDensity, got, tc.want)
+		}
+	}
+}
+
+func TestBelowThresholdKeepsCounts(t *testing.T) {
+	job := Job{VideoID: "threshold01", Options: defaultScanOptions()}
+	job.Options.MinHits = 3
+	transcript := testTranscript("en", captionsManual, "oh shit", "well damn")
+	scan, err := scanTranscript(job, currentDictionary(), transcript, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := scan.response
+	if response.Profanity {
+		t.Error("flagged with fewer hits than min_hits")
+	}
+	if response.ProfanityCount != 2 || len(response.ProfaneWords) != 2 || response.ProfanityDensity == 0 {
+		t.Errorf("count = %d, words = %v, density = %v, want the raw figures", response.ProfanityCount, response.ProfaneWords, response.ProfanityDensity)
+	}
+}
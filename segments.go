@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// Segment limit modes
+const (
+	segmentLimitTruncate = "truncate" // keep the first N segments
+	segmentLimitSample   = "sample"   // keep N segments spread evenly across the video
+)
+
+// limitSegments caps the number of transcript lines that will be scanned.
+// It returns the lines to use and whether anything was dropped.
+func limitSegments(lines []yt_transcript_models.TranscriptLine, max int, mode string) ([]yt_transcript_models.TranscriptLine, bool) {
+	if max <= 0 || len(lines) <= max {
+		return lines, false
+	}
+
+	if mode == segmentLimitSample {
+		sampled := make([]yt_transcript_models.TranscriptLine, 0, max)
+		step := float64(len(lines)) / float64(max)
+		for i := 0; i < max; i++ {
+			sampled = append(sampled, lines[int(float64(i)*step)])
+		}
+		return sampled, true
+	}
+
+	return lines[:max], true
+}
+
+// limitTranscriptChars keeps whole lines from the start of the transcript
+// until their text, joined with spaces, would exceed max characters. It
+// returns the lines to use and whether anything was dropped.
+func limitTranscriptChars(lines []yt_transcript_models.TranscriptLine, max int) ([]yt_transcript_models.TranscriptLine, bool) {
+	if max <= 0 {
+		return lines, false
+	}
+	total := 0
+	for i, line := range lines {
+		if i > 0 {
+			total++ // Separator
+		}
+		total += utf8.RuneCountInString(line.Text)
+		if total > max {
+			return lines[:i], true
+		}
+	}
+	return lines, false
+}
+
+// selectEdgeSegments keeps only the lines that overlap the first headSeconds
+// and/or the last tailSeconds of the video. A zero value disables that edge;
+// when both are zero all lines are returned. Windows longer than the video
+// simply cover the whole transcript.
+func selectEdgeSegments(lines []yt_transcript_models.TranscriptLine, headSeconds, tailSeconds float64) []yt_transcript_models.TranscriptLine {
+	if (headSeconds <= 0 && tailSeconds <= 0) || len(lines) == 0 {
+		return lines
+	}
+
+	tailStart := transcriptEnd(lines) - tailSeconds
+
+	selected := make([]yt_transcript_models.TranscriptLine, 0, len(lines))
+	for _, line := range lines {
+		inHead := headSeconds > 0 && line.Start < headSeconds
+		inTail := tailSeconds > 0 && line.Start+line.Duration > tailStart
+		if inHead || inTail {
+			selected = append(selected, line)
+		}
+	}
+	return selected
+}
+
+// TimeRange is a span of the video in seconds
+type TimeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// transcriptEnd is when the last line ends, which approximates the video
+// length
+func transcriptEnd(lines []yt_transcript_models.TranscriptLine) float64 {
+	var videoEnd float64
+	for _, line := range lines {
+		if end := line.Start + line.Duration; end > videoEnd {
+			videoEnd = end
+		}
+	}
+	return videoEnd
+}
+
+// selectTimeRange keeps only the lines that overlap the start and end
+// seconds, with end 0 meaning the end of the video. The range is clamped to
+// the video length and returned as actually scanned.
+func selectTimeRange(lines []yt_transcript_models.TranscriptLine, start, end float64) ([]yt_transcript_models.TranscriptLine, TimeRange) {
+	videoEnd := transcriptEnd(lines)
+	if end <= 0 || end > videoEnd {
+		end = videoEnd
+	}
+	start = min(start, end)
+
+	selected := make([]yt_transcript_models.TranscriptLine, 0, len(lines))
+	for _, line := range lines {
+		if line.Start < end && line.Start+line.Duration > start {
+			selected = append(selected, line)
+		}
+	}
+	return selected, TimeRange{Start: start, End: end}
+}
+
+// dedupeSegments removes text that auto-captions repeat across consecutive
+// segments. For each line, the longest run of leading words that matches the
+// trailing words of the previous line is dropped; lines left empty are
+// removed entirely. A single shared word is only treated as overlap when the
+// two lines are on screen at the same time, since otherwise it is as likely
+// to be said twice ("fuck" then "fuck this"). It returns the cleaned lines and
+// how many lines overlapped their predecessor.
+func dedupeSegments(lines []yt_transcript_models.TranscriptLine) ([]yt_transcript_models.TranscriptLine, int) {
+	deduped := make([]yt_transcript_models.TranscriptLine, 0, len(lines))
+	overlaps := 0
+	var previous []string
+	var previousEnd float64
+
+	for _, line := range lines {
+		words := strings.Fields(line.Text)
+		overlap := segmentOverlap(previous, words)
+		if overlap < minSegmentOverlap && line.Start >= previousEnd {
+			overlap = 0
+		}
+		if overlap > 0 {
+			overlaps++
+			words = words[overlap:]
+		}
+		// Compare the next line against what was actually spoken here,
+		// including any overlap we just trimmed
+		previous = strings.Fields(line.Text)
+		previousEnd = line.Start + line.Duration
+
+		if len(words) == 0 {
+			continue
+		}
+		line.Text = strings.Join(words, " ")
+		deduped = append(deduped, line)
+	}
+	return deduped, overlaps
+}
+
+// minSegmentOverlap is how many words consecutive lines must share to count
+// as overlap when their timestamps don't overlap
+const minSegmentOverlap = 2
+
+// segmentOverlap returns the length of the longest suffix of previous that is
+// also a prefix of current, compared case-insensitively
+func segmentOverlap(previous, current []string) int {
+	max := len(previous)
+	if len(current) < max {
+		max = len(current)
+	}
+	for n := max; n > 0; n-- {
+		matched := true
+		for i := 0; i < n; i++ {
+			if !strings.EqualFold(previous[len(previous)-n+i], current[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return n
+		}
+	}
+	return 0
+}
+
+// Segment is a stretch of the transcript containing a profane word
+type Segment struct {
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Word     string  `json:"word"`            // As it appeared in the transcript
+	Track    string  `json:"track,omitempty"` // Caption track of the hit, only with tracks=all
+}
+
+// profanitySegments scans the transcript line by line so each hit keeps the
+// timing of the caption it came from. A line with several hits yields one
+// segment per hit. Phrases split across two captions aren't found here.
+func profanitySegments(dict *dictionary, lines []yt_transcript_models.TranscriptLine, options MatchOptions) []Segment {
+	segments := []Segment{}
+	for _, line := range lines {
+		matchTokens(dict, tokenize(line.Text), options, func(entry string, _ int, span []string) {
+			segments = append(segments, Segment{
+				Start:    line.Start,
+				Duration: line.Duration,
+				Word:     spanSurfaceForm(span),
+			})
+		})
+	}
+	return segments
+}
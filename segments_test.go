@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+// numberedLines returns n one-second lines "line 0", "line 1"... starting at
+// second 0
+func numberedLines(n int) []yt_transcript_models.TranscriptLine {
+	lines := make([]yt_transcript_models.TranscriptLine, n)
+	for i := range lines {
+		lines[i] = yt_transcript_models.TranscriptLine{Text: fmt.Sprintf("line %d", i), Start: float64(i), Duration: 1}
+	}
+	return lines
+}
+
+// lineTexts lists the text of each line
+func lineTexts(lines []yt_transcript_models.TranscriptLine) []string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return texts
+}
+
+func TestLimitSegments(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     int
+		max       int
+		mode      string
+		want      []string
+		truncated bool
+	}{
+		{"no limit", 3, 0, segmentLimitTruncate, []string{"line 0", "line 1", "line 2"}, false},
+		{"under the limit", 3, 5, segmentLimitTruncate, []string{"line 0", "line 1", "line 2"}, false},
+		{"exactly the limit", 3, 3, segmentLimitTruncate, []string{"line 0", "line 1", "line 2"}, false},
+		{"truncate keeps the start", 10, 3, segmentLimitTruncate, []string{"line 0", "line 1", "line 2"}, true},
+		{"sample spreads evenly", 10, 5, segmentLimitSample, []string{"line 0", "line 2", "line 4", "line 6", "line 8"}, true},
+		{"sample uneven step", 10, 3, segmentLimitSample, []string{"line 0", "line 3", "line 6"}, true},
+		{"empty transcript", 0, 3, segmentLimitTruncate, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := limitSegments(numberedLines(tt.lines), tt.max, tt.mode)
+			if truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.truncated)
+			}
+			if fmt.Sprint(lineTexts(got)) != fmt.Sprint(tt.want) {
+				t.Errorf("lines = %q, want %q", lineTexts(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectEdgeSegments(t *testing.T) {
+	tests := []struct {
+		name       string
+		head, tail float64
+		want       []string
+	}{
+		{"both off", 0, 0, []string{"line 0", "line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9"}},
+		{"head only", 3, 0, []string{"line 0", "line 1", "line 2"}},
+		{"tail only", 0, 2, []string{"line 8", "line 9"}},
+		{"head and tail", 2, 2, []string{"line 0", "line 1", "line 8", "line 9"}},
+		{"overlapping windows keep lines once", 6, 6, []string{"line 0", "line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9"}},
+		{"window longer than the video", 60, 0, []string{"line 0", "line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9"}},
+		{"line straddling the head edge", 2.5, 0, []string{"line 0", "line 1", "line 2"}},
+		{"line straddling the tail edge", 0, 1.5, []string{"line 8", "line 9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectEdgeSegments(numberedLines(10), tt.head, tt.tail)
+			if fmt.Sprint(lineTexts(got)) != fmt.Sprint(tt.want) {
+				t.Errorf("lines = %q, want %q", lineTexts(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectEdgeSegmentsEmpty(t *testing.T) {
+	if got := selectEdgeSegments(nil, 5, 5); len(got) != 0 {
+		t.Errorf("got %d lines from an empty transcript", len(got))
+	}
+}
+
+func TestDedupeSegments(t *testing.T) {
+	line := func(text string, start, duration float64) yt_transcript_models.TranscriptLine {
+		return yt_transcript_models.TranscriptLine{Text: text, Start: start, Duration: duration}
+	}
+	tests := []struct {
+		name     string
+		lines    []yt_transcript_models.TranscriptLine
+		want     []string
+		overlaps int
+	}{
+		{"rolling captions", []yt_transcript_models.TranscriptLine{
+			line("oh what the fuck", 0, 2), line("the fuck is that", 2, 2), line("is that a bear", 4, 2),
+		}, []string{"oh what the fuck", "is that", "a bear"}, 2},
+		{"overlap is case insensitive", []yt_transcript_models.TranscriptLine{
+			line("What The", 0, 1), line("the hell", 1, 1), line("THE HELL man", 2, 1),
+		}, []string{"What The", "the hell", "man"}, 1},
+		{"genuine repeat of one word", []yt_transcript_models.TranscriptLine{
+			line("fuck", 0, 1), line("fuck this", 1, 1),
+		}, []string{"fuck", "fuck this"}, 0},
+		{"one word shared while both lines are on screen", []yt_transcript_models.TranscriptLine{
+			line("well fuck", 0, 2), line("fuck this", 1, 2),
+		}, []string{"well fuck", "this"}, 1},
+		{"whole line repeated", []yt_transcript_models.TranscriptLine{
+			line("no way man", 0, 1), line("no way man", 1, 1), line("really", 2, 1),
+		}, []string{"no way man", "really"}, 1},
+		{"no overlap", []yt_transcript_models.TranscriptLine{
+			line("hello there", 0, 1), line("general kenobi", 1, 1),
+		}, []string{"hello there", "general kenobi"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, overlaps := dedupeSegments(tt.lines)
+			if fmt.Sprint(lineTexts(got)) != fmt.Sprint(tt.want) {
+				t.Errorf("lines = %q, want %q", lineTexts(got), tt.want)
+			}
+			if overlaps != tt.overlaps {
+				t.Errorf("overlaps = %d, want %d", overlaps, tt.overlaps)
+			}
+		})
+	}
+}
+
+func TestDedupeCountsSwearsOnce(t *testing.T) {
+	withoutFallbacks(t)
+	tests := []struct {
+		name  string
+		texts []string
+		want  int
+	}{
+		{"rolling captions", []string{"oh what the fuck", "the fuck is that"}, 1},
+		{"genuine repeat", []string{"fuck", "fuck this"}, 2},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startTestWorkers(t, fetcherFunc(func(string, []string) ([]yt_transcript_models.Transcript, error) {
+				return []yt_transcript_models.Transcript{testTranscript("en", captionsAuto, tt.texts...)}, nil
+			}))
+			options := defaultScanOptions()
+			options.Dedupe = true
+			response := runJob(Job{VideoID: fmt.Sprintf("dedupe%05d", i), Languages: []string{"en"}, Options: options})
+			if response.Error != "" {
+				t.Fatal(response.Error)
+			}
+			if response.ProfanityCount != tt.want {
+				t.Errorf("profanity count = %d, want %d", response.ProfanityCount, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// fetchErrorTypes lists every value fetchErrorType returns
+var fetchErrorTypes = []string{
+	"cancelled", "throttled", "panic", "empty", "caption_kind", "captions_not_found", "private", "unavailable", "timeout", "network", "other",
+}
+
+// stats mirrors the main Prometheus metrics in plain counters for
+// /admin/stats, for deployments without a Prometheus server
+var stats = newRuntimeStats()
+
+type runtimeStats struct {
+	requests       atomic.Int64
+	latencyNanos   atomic.Int64
+	cacheHits      atomic.Int64
+	cacheMisses    atomic.Int64
+	profaneResults atomic.Int64
+	cleanResults   atomic.Int64
+	fetchFailures  map[string]*atomic.Int64 // By fetchErrorType, fixed at creation
+}
+
+func newRuntimeStats() *runtimeStats {
+	s := &runtimeStats{fetchFailures: make(map[string]*atomic.Int64, len(fetchErrorTypes))}
+	for _, errorType := range fetchErrorTypes {
+		s.fetchFailures[errorType] = new(atomic.Int64)
+	}
+	return s
+}
+
+func (s *runtimeStats) recordRequest(latency time.Duration) {
+	s.requests.Add(1)
+	s.latencyNanos.Add(int64(latency))
+}
+
+func (s *runtimeStats) recordFetchFailure(errorType string) {
+	if counter, ok := s.fetchFailures[errorType]; ok {
+		counter.Add(1)
+	}
+}
+
+func (s *runtimeStats) recordResult(profane bool) {
+	if profane {
+		s.profaneResults.Add(1)
+	} else {
+		s.cleanResults.Add(1)
+	}
+}
+
+// StatsResponse is returned by /admin/stats. Counters start at zero when the
+// process starts.
+type StatsResponse struct {
+	Requests         int64            `json:"requests"`
+	AverageLatencyMs float64          `json:"average_latency_ms"`
+	CacheHits        int64            `json:"cache_hits"`
+	CacheMisses      int64            `json:"cache_misses"`
+	CacheHitRatio    float64          `json:"cache_hit_ratio"` // 0 before the first lookup
+	ProfaneResults   int64            `json:"profane_results"`
+	CleanResults     int64            `json:"clean_results"`
+	FetchFailures    map[string]int64 `json:"fetch_failures"` // By error type
+}
+
+func (s *runtimeStats) snapshot() StatsResponse {
+	response := StatsResponse{
+		Requests:       s.requests.Load(),
+		CacheHits:      s.cacheHits.Load(),
+		CacheMisses:    s.cacheMisses.Load(),
+		ProfaneResults: s.profaneResults.Load(),
+		CleanResults:   s.cleanResults.Load(),
+		FetchFailures:  make(map[string]int64, len(s.fetchFailures)),
+	}
+	if response.Requests > 0 {
+		average := float64(s.latencyNanos.Load()) / float64(response.Requests) / float64(time.Millisecond)
+		response.AverageLatencyMs = math.Round(average*100) / 100
+	}
+	if lookups := response.CacheHits + response.CacheMisses; lookups > 0 {
+		response.CacheHitRatio = math.Round(float64(response.CacheHits)/float64(lookups)*10000) / 10000
+	}
+	for errorType, counter := range s.fetchFailures {
+		response.FetchFailures[errorType] = counter.Load()
+	}
+	return response
+}
+
+// statsHandler reports the runtime counters
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats.snapshot())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// TrackResult summarises the scan of one caption track, see tracks=all
+type TrackResult struct {
+	Track          string      `json:"track"` // Label used on segments and word counts, see trackLabel
+	Language       string      `json:"language"`
+	CaptionType    captionKind `json:"caption_type"`
+	Profanity      bool        `json:"profanity"`
+	ProfaneWords   []string    `json:"profane_words"`
+	ProfanityCount int         `json:"profanity_count"`
+	ProfanityScore int         `json:"profanity_score"`
+}
+
+// trackLabel names a caption track, such as "en/manual"
+func trackLabel(response TranscriptResponse) string {
+	return response.Language + "/" + string(response.CaptionType)
+}
+
+// mergeTrackScans combines the scans of several tracks of the same language
+// into the worst case. Manual and auto captions often disagree, so a word
+// either one heard counts: each dictionary entry keeps the highest count any
+// track had and every hit is listed with the track it came from. The rest of
+// the response, such as the language, coverage, transcript and match offsets,
+// is the worst track's.
+func mergeTrackScans(scans []trackScan, options ScanOptions) TranscriptResponse {
+	worst := 0
+	for i, scan := range scans {
+		if worseTrack(scan.response, scans[worst].response) {
+			worst = i
+		}
+	}
+	merged := scans[worst].response
+	merged.ProfaneWords = []string{}
+	merged.WordCounts = []WordCount{}
+	merged.ProfanitySegments = []Segment{}
+	merged.Contexts = nil
+	merged.Categories = []string{}
+
+	counts := make(map[string]int)
+	wordCounts := make(map[string]WordCount)
+	var entries []string // In order of first appearance, like matches.breakdown
+	for _, scan := range scans {
+		response := scan.response
+		label := trackLabel(response)
+		merged.Tracks = append(merged.Tracks, TrackResult{
+			Track:          label,
+			Language:       response.Language,
+			CaptionType:    response.CaptionType,
+			Profanity:      response.Profanity,
+			ProfaneWords:   response.ProfaneWords,
+			ProfanityCount: response.ProfanityCount,
+			ProfanityScore: response.ProfanityScore,
+		})
+
+		for entry, count := range scan.counts {
+			counts[entry] = max(counts[entry], count)
+		}
+		for _, wordCount := range response.WordCounts {
+			if _, seen := wordCounts[wordCount.Entry]; !seen {
+				entries = append(entries, wordCount.Entry)
+			}
+			if wordCount.Count > wordCounts[wordCount.Entry].Count {
+				wordCount.Track = label
+				wordCounts[wordCount.Entry] = wordCount
+			}
+		}
+		for _, word := range response.ProfaneWords {
+			if !slices.Contains(merged.ProfaneWords, word) {
+				merged.ProfaneWords = append(merged.ProfaneWords, word)
+			}
+		}
+		for _, category := range response.Categories {
+			if !slices.Contains(merged.Categories, category) {
+				merged.Categories = append(merged.Categories, category)
+			}
+		}
+		for _, segment := range response.ProfanitySegments {
+			segment.Track = label
+			merged.ProfanitySegments = append(merged.ProfanitySegments, segment)
+		}
+		merged.Contexts = append(merged.Contexts, response.Contexts...)
+		merged.MaxSeverity = max(merged.MaxSeverity, response.MaxSeverity)
+		merged.ProfanityDensity = max(merged.ProfanityDensity, response.ProfanityDensity)
+	}
+
+	merged.ProfanityCount = 0
+	for _, count := range counts {
+		merged.ProfanityCount += count
+	}
+	for _, entry := range entries {
+		merged.WordCounts = append(merged.WordCounts, wordCounts[entry])
+	}
+	sort.SliceStable(merged.ProfanitySegments, func(i, j int) bool {
+		return merged.ProfanitySegments[i].Start < merged.ProfanitySegments[j].Start
+	})
+
+	merged.Profanity = meetsThreshold(merged.ProfanityCount, merged.ProfanityDensity, options.MinHits, options.MinDensity)
+	for _, track := range merged.Tracks {
+		merged.Profanity = merged.Profanity || track.Profanity
+	}
+	merged.SeverityScore = repetitionScore(counts, repetitionExponent)
+	merged.AudienceRating = rateAudience(merged.SeverityScore, audienceRatings)
+	merged.ProfanityScore = profanityScore(merged.ProfanityCount, merged.ProfanityDensity,
+		merged.MaxSeverity, profanityScoreWeights)
+	return merged
+}
+
+// worseTrack reports whether a scored worse than b. Ties go to b, which
+// comes first and is the manual track when there is one.
+func worseTrack(a, b TranscriptResponse) bool {
+	if a.ProfanityScore != b.ProfanityScore {
+		return a.ProfanityScore > b.ProfanityScore
+	}
+	return a.ProfanityCount > b.ProfanityCount
+}
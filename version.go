@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Build details injected at build time, e.g.
+//
+//	go build -ldflags "-X main.gitCommit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Left empty, they fall back to the VCS stamp the go tool records when
+// building inside a git checkout, see readBuildInfo.
+var (
+	gitCommit string
+	buildTime string
+)
+
+// VersionResponse identifies the running build and dictionary
+type VersionResponse struct {
+	Commit         string `json:"commit"`               // "unknown" when the build wasn't stamped
+	BuildTime      string `json:"build_time,omitempty"` // RFC 3339, or the commit time for VCS stamps
+	Modified       bool   `json:"modified,omitempty"`   // Built from a checkout with uncommitted changes
+	GoVersion      string `json:"go_version"`
+	DictVersion    string `json:"dict_version"` // See computeDictionaryVersion
+	Dictionary     string `json:"dictionary"`   // Where the loaded word list came from, as in /healthz
+	ProfanityWords int    `json:"profanity_words"`
+}
+
+// buildVersion is the build part of VersionResponse, read once
+var buildVersion = sync.OnceValue(readBuildInfo)
+
+// readBuildInfo prefers the ldflags values and fills in whatever they leave
+// out from the build info embedded in the binary
+func readBuildInfo() VersionResponse {
+	version := VersionResponse{
+		Commit:    gitCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if version.Commit == "" {
+					version.Commit = setting.Value
+				}
+			case "vcs.time":
+				if version.BuildTime == "" {
+					version.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				version.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if version.Commit == "" {
+		version.Commit = "unknown"
+	}
+	return version
+}
+
+// versionHandler reports which build and which dictionary are serving
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	dict := currentDictionary()
+	response := buildVersion()
+	response.DictVersion = dict.version
+	response.Dictionary = dict.source
+	response.ProfanityWords = len(dict.words)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
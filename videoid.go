@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// videoIDPattern matches a bare YouTube video ID
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+var errInvalidVideoID = errors.New("could not find a valid YouTube video ID")
+
+// extractVideoID accepts either a bare 11-character video ID or a YouTube URL
+// in any of the common shapes and returns the video ID:
+//
+//	dQw4w9WgXcQ
+//	https://www.youtube.com/watch?v=dQw4w9WgXcQ
+//	https://youtu.be/dQw4w9WgXcQ?t=42
+//	https://www.youtube.com/embed/dQw4w9WgXcQ
+//	https://www.youtube.com/shorts/dQw4w9WgXcQ
+func extractVideoID(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if videoIDPattern.MatchString(raw) {
+		return raw, nil
+	}
+
+	// Allow URLs pasted without a scheme
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errInvalidVideoID
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var candidate string
+	switch host {
+	case "youtu.be":
+		candidate = segments[0]
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if len(segments) == 1 && segments[0] == "watch" {
+			candidate = u.Query().Get("v")
+		} else if len(segments) >= 2 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live" || segments[0] == "v") {
+			candidate = segments[1]
+		}
+	}
+
+	if !videoIDPattern.MatchString(candidate) {
+		return "", errInvalidVideoID
+	}
+	return candidate, nil
+}
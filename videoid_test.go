@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+func TestExtractVideoID(t *testing.T) {
+	tests := []struct {
+		name, raw string
+	}{
+		{"bare id", "dQw4w9WgXcQ"},
+		{"bare id with spaces", "  dQw4w9WgXcQ\n"},
+		{"watch url", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"watch url with extra params", "https://www.youtube.com/watch?list=PL123&v=dQw4w9WgXcQ&t=42s"},
+		{"mobile watch url", "https://m.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"music url", "https://music.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"no scheme", "youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"shorts", "https://www.youtube.com/shorts/dQw4w9WgXcQ"},
+		{"shorts with trailing slash", "https://youtube.com/shorts/dQw4w9WgXcQ/"},
+		{"embed", "https://www.youtube.com/embed/dQw4w9WgXcQ"},
+		{"nocookie embed", "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ"},
+		{"live", "https://www.youtube.com/live/dQw4w9WgXcQ"},
+		{"youtu.be", "https://youtu.be/dQw4w9WgXcQ"},
+		{"youtu.be with timestamp", "https://youtu.be/dQw4w9WgXcQ?t=42"},
+		{"youtu.be without scheme", "youtu.be/dQw4w9WgXcQ"},
+		{"uppercase host", "https://WWW.YOUTUBE.COM/watch?v=dQw4w9WgXcQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractVideoID(tt.raw)
+			if err != nil || got != "dQw4w9WgXcQ" {
+				t.Errorf("extractVideoID(%q) = %q, %v", tt.raw, got, err)
+			}
+		})
+	}
+}
+
+func TestExtractVideoIDInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"dQw4w9WgXc",   // Too short
+		"dQw4w9WgXcQQ", // Too long
+		"https://www.youtube.com/watch",
+		"https://www.youtube.com/watch?v=short",
+		"https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw",
+		"https://youtu.be/",
+		"https://vimeo.com/dQw4w9WgXcQ",
+		"https://example.com/watch?v=dQw4w9WgXcQ",
+	} {
+		if got, err := extractVideoID(raw); !errors.Is(err, errInvalidVideoID) {
+			t.Errorf("extractVideoID(%q) = %q, %v, want errInvalidVideoID", raw, got, err)
+		}
+	}
+}
+
+func TestTranscriptHandlerAcceptsURLs(t *testing.T) {
+	withoutFallbacks(t)
+	var fetched []string
+	var mu sync.Mutex
+	startTestWorkers(t, fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+		mu.Lock()
+		fetched = append(fetched, videoID)
+		mu.Unlock()
+		return []yt_transcript_models.Transcript{testTranscript("en", captionsManual, "hello there")}, nil
+	}))
+
+	for _, raw := range []string{
+		"https://www.youtube.com/watch?v=urlTest0001",
+		"https://youtu.be/urlTest0002?t=42",
+		"https://www.youtube.com/shorts/urlTest0003",
+	} {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?no_cache=true&url="+url.QueryEscape(raw), nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", raw, rec.Code, rec.Body)
+		}
+	}
+	// A bare ID in the path
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/transcript/urlTest0004?no_cache=true", nil), map[string]string{"video_id": "urlTest0004"})
+	rec := httptest.NewRecorder()
+	getTranscriptHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("path ID: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	want := []string{"urlTest0001", "urlTest0002", "urlTest0003", "urlTest0004"}
+	if !slices.Equal(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+}
+
+func TestTranscriptHandlerRejectsMalformedURLs(t *testing.T) {
+	for _, raw := range []string{"https://vimeo.com/12345", "not a video", "https://www.youtube.com/watch?v=short"} {
+		rec := httptest.NewRecorder()
+		getTranscriptHandler(rec, httptest.NewRequest("GET", "/transcript?url="+url.QueryEscape(raw), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", raw, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "Invalid video ID or YouTube URL") {
+			t.Errorf("%s: body = %s", raw, rec.Body)
+		}
+	}
+}
+
+func TestBatchJobsAcceptURLs(t *testing.T) {
+	jobs, err := batchJobs(BatchRequest{
+		VideoIDs: []string{"https://youtu.be/dQw4w9WgXcQ"},
+		Videos:   []BatchItem{{VideoID: "https://www.youtube.com/embed/dQw4w9WgXcQ", Lang: "es"}},
+	}, defaultScanOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.VideoID != "dQw4w9WgXcQ" {
+			t.Errorf("video ID = %q", job.VideoID)
+		}
+	}
+	if _, err := batchJobs(BatchRequest{VideoIDs: []string{"https://vimeo.com/1"}}, defaultScanOptions()); err == nil {
+		t.Error("batch with an invalid URL accepted")
+	}
+}
+
+func TestBatchJobsLanguages(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  BatchRequest
+		want []string // Languages of each job, in order
+	}{
+		{"no language anywhere", BatchRequest{
+			VideoIDs: []string{"langtest001"},
+			Videos:   []BatchItem{{VideoID: "langtest002"}},
+		}, []string{"en", "en"}},
+		{"batch default", BatchRequest{
+			VideoIDs: []string{"langtest001"},
+			Videos:   []BatchItem{{VideoID: "langtest002"}},
+			Lang:     "fr",
+		}, []string{"fr", "fr"}},
+		{"per-item override", BatchRequest{
+			Videos: []BatchItem{{VideoID: "langtest001", Lang: "de"}, {VideoID: "langtest002"}},
+			Lang:   "fr",
+		}, []string{"de", "fr"}},
+		{"override without a default", BatchRequest{
+			VideoIDs: []string{"langtest001"},
+			Videos:   []BatchItem{{VideoID: "langtest002", Lang: "es"}, {VideoID: "langtest003"}},
+		}, []string{"en", "es", "en"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs, err := batchJobs(tc.req, defaultScanOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != len(tc.want) {
+				t.Fatalf("%d jobs, want %d", len(jobs), len(tc.want))
+			}
+			for i, job := range jobs {
+				if !slices.Equal(job.Languages, []string{tc.want[i]}) {
+					t.Errorf("job %d (%s) languages = %v, want [%s]", i, job.VideoID, job.Languages, tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// youtubeTransport carries every request to YouTube, transcripts and
+// metadata alike, unless YT_PROXY_URL is set, see proxiedTransport. It
+// honours HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+var youtubeTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// youtubeHTTPClient is used by htmlFetcher
+var youtubeHTTPClient = &http.Client{
+	Timeout:   30 * time.Second,
+	Transport: proxiedTransport{},
+}
+
+// parseProxyURL validates one YT_PROXY_URL entry
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, errors.New("proxy URL has no host")
+	}
+	return proxyURL, nil
+}
+
+// YouTube endpoints and payloads used by htmlFetcher, matching the
+// transcript library
+const (
+	youtubeWatchURL     = "https://www.youtube.com/watch?v=%s"
+	youtubeInnertubeURL = "https://www.youtube.com/youtubei/v1/player?key=%s"
+)
+
+var youtubeInnertubeContext = map[string]interface{}{
+	"client": map[string]interface{}{
+		"clientName":    "ANDROID",
+		"clientVersion": "20.10.38",
+	},
+}
+
+// errYouTubeThrottled is returned when YouTube answers 429 Too Many Requests
+// or serves its bot check instead of the video. Retrying the same way only
+// makes it worse, so fetchTranscript gives up on the video at once unless
+// another proxy is available, see proxyPool.
+var errYouTubeThrottled = errors.New("YouTube is rate limiting or blocking requests")
+
+// botCheckMarkers appear in YouTube's "confirm you're not a bot" responses
+var botCheckMarkers = []string{
+	"confirm you're not a bot",
+	`confirm you\u2019re not a bot`, // Escaped inside the page's JSON
+	"confirm you’re not a bot",
+	"/sorry/index",
+}
+
+// isBotCheck reports whether a response body is YouTube's bot check
+func isBotCheck(body []byte) bool {
+	lower := bytes.ToLower(body)
+	for _, marker := range botCheckMarkers {
+		if bytes.Contains(lower, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	consentFormPattern  = regexp.MustCompile(`action="https://consent\.youtube\.com/s`)
+	consentValuePattern = regexp.MustCompile(`name="v" value="(.*?)"`)
+)
+
+// htmlFetcher does the transcript library's HTTP requests through
+// youtubeHTTPClient, so they can be proxied; the library's own client ignores
+// proxy settings. Each call makes a single request, retries are left to
+// fetchTranscript.
+type htmlFetcher struct{}
+
+func (f htmlFetcher) Fetch(url string, cookie *http.Cookie) ([]byte, error) {
+	return f.FetchWithContext(context.Background(), url, cookie)
+}
+
+func (f htmlFetcher) FetchWithContext(ctx context.Context, url string, cookie *http.Cookie) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept-Language", "en-US")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	proxy := youtubeProxies.pick()
+	body, err := f.fetchBody(withProxy(req, proxy))
+	youtubeProxies.report(proxy, err)
+	return body, err
+}
+
+func (f htmlFetcher) fetchBody(req *http.Request) ([]byte, error) {
+	resp, err := youtubeHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer closeBody(resp)
+	if err := checkYouTubeStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if len(body) == 0 {
+		return nil, errors.New("empty response body")
+	}
+	if isBotCheck(body) {
+		return nil, fmt.Errorf("%w: bot check page", errYouTubeThrottled)
+	}
+	return body, nil
+}
+
+// FetchVideo fetches the watch page, accepting the cookie consent form
+// YouTube shows to some regions first
+func (f htmlFetcher) FetchVideo(videoID string) ([]byte, error) {
+	videoURL := fmt.Sprintf(youtubeWatchURL, videoID)
+	body, err := f.Fetch(videoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch video page: %w", err)
+	}
+	if !consentFormPattern.Match(body) {
+		return body, nil
+	}
+
+	match := consentValuePattern.FindSubmatch(body)
+	if len(match) < 2 {
+		return nil, errors.New("failed to create consent cookie: consent value not found")
+	}
+	cookie := &http.Cookie{Name: "CONSENT", Value: "YES+" + string(match[1]), Domain: ".youtube.com"}
+	body, err = f.Fetch(videoURL, cookie)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch video page after setting consent: %w", err)
+	}
+	return body, nil
+}
+
+func (f htmlFetcher) FetchInnertubeData(videoID string, apiKey string) (map[string]interface{}, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"context": youtubeInnertubeContext,
+		"videoId": videoID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(youtubeInnertubeURL, apiKey), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	proxy := youtubeProxies.pick()
+	data, err := f.fetchInnertube(withProxy(req, proxy))
+	youtubeProxies.report(proxy, err)
+	return data, err
+}
+
+func (f htmlFetcher) fetchInnertube(req *http.Request) (map[string]interface{}, error) {
+	resp, err := youtubeHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute HTTP request: %w", err)
+	}
+	defer closeBody(resp)
+	if err := checkYouTubeStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode response JSON: %w", err)
+	}
+	// A bot check comes back as a playability status with no captions
+	if status, ok := data["playabilityStatus"].(map[string]interface{}); ok {
+		if reason, _ := status["reason"].(string); isBotCheck([]byte(reason)) {
+			return nil, fmt.Errorf("%w: %s", errYouTubeThrottled, reason)
+		}
+	}
+	return data, nil
+}
+
+// maxDrainBytes is how much of an unread response body closeBody reads
+const maxDrainBytes = 64 << 10
+
+// closeBody reads what's left of a response body before closing it. A body
+// closed unread makes the transport drop the connection, so every retry after
+// an error response would dial again.
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+}
+
+// checkYouTubeStatus turns a non-OK response into an error. Server errors
+// are reported as temporary so fetchTranscript retries them, 429 as
+// errYouTubeThrottled.
+func checkYouTubeStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", errYouTubeThrottled, resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("temporary YouTube server error: status %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("received non-OK status code: %d", resp.StatusCode)
+	}
+}
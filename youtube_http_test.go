@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript_models"
+)
+
+func TestRetriesReuseOneConnection(t *testing.T) {
+	noRetrySleep(t)
+	// Each video fails twice with a retryable server error before loading
+	var mu sync.Mutex
+	served := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served[r.URL.Query().Get("v")]++
+		n := served[r.URL.Query().Get("v")]
+		mu.Unlock()
+		if n < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html>video page</html>"))
+	}))
+	defer server.Close()
+
+	var dials atomic.Int32
+	previous := youtubeTransport
+	youtubeTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(func() {
+		youtubeTransport.CloseIdleConnections()
+		youtubeTransport = previous
+	})
+
+	// Separate fetchers, as each worker has its own
+	for i, videoID := range []string{"reuse000001", "reuse000002", "reuse000003"} {
+		fetcher := fetcherFunc(func(videoID string, langs []string) ([]yt_transcript_models.Transcript, error) {
+			if _, err := (htmlFetcher{}).Fetch(server.URL+"/watch?v="+videoID, nil); err != nil {
+				return nil, err
+			}
+			return []yt_transcript_models.Transcript{testTranscript(langs[0], captionsManual, "hello there")}, nil
+		})
+		_, _, attempts, err := fetchTranscript(context.Background(), fetcher, videoID, []string{"en"}, captionsAny)
+		if err != nil {
+			t.Fatalf("video %d: %v", i, err)
+		}
+		if attempts[0].Attempts != 3 {
+			t.Errorf("video %d: attempts = %d, want 3", i, attempts[0].Attempts)
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("dialled %d connections for 9 requests, want 1 reused throughout", got)
+	}
+}